@@ -0,0 +1,248 @@
+package ginlib
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AccessLogConfig 访问日志配置，零值与GinLogger一致
+type AccessLogConfig struct {
+	SkipPaths        []string      //不记录日志的路径，以*结尾时按前缀匹配，如/health、/metrics、/static/*
+	BodyMaxBytes     int           //记录请求与响应体的最大字节数，0不记录
+	BodyContentTypes []string      //记录请求与响应体的内容类型，按前缀匹配，默认application/json、application/x-www-form-urlencoded、text/plain
+	Headers          bool          //是否记录请求头
+	RedactFields     []string      //脱敏的json字段与表单参数，不区分大小写，默认password、pwd、token、secret、id_card、idcard
+	RedactHeaders    []string      //脱敏的请求头，默认Authorization、Cookie、X-Inner-Sign
+	SlowThreshold    time.Duration //慢请求阈值，超过时以warn级别记录，0不区分
+	SampleRate       float64       //成功请求(状态码<400且非慢请求)的采样比例，取值(0,1)，其他值记录全部
+}
+
+const redactMask = "***"
+
+// accessLogger 根据配置预先编译的访问日志
+type accessLogger struct {
+	conf          AccessLogConfig
+	skipPaths     map[string]bool
+	skipPrefixes  []string
+	redactHeaders map[string]bool
+	jsonRegexp    *regexp.Regexp
+	formRegexp    *regexp.Regexp
+}
+
+// GinLogger 接收gin框架的http请求日志，不记录请求体，需要过滤路径、记录请求体或采样时使用GinLoggerWithConfig
+func GinLogger() gin.HandlerFunc {
+	return GinLoggerWithConfig(AccessLogConfig{})
+}
+
+// GinLoggerWithConfig 可配置的访问日志，支持请求与响应体记录、字段脱敏、慢请求升级日志级别、成功请求采样与路径过滤
+func GinLoggerWithConfig(conf AccessLogConfig) gin.HandlerFunc {
+	l := newAccessLogger(conf)
+	return func(c *gin.Context) {
+		if l.skip(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		path := c.Request.URL.Path
+		query := c.Request.URL.RawQuery
+
+		var reqBody []byte
+		var respWriter *accessLogWriter
+		if conf.BodyMaxBytes > 0 {
+			if c.Request.Body != nil && l.captureType(c.ContentType()) {
+				reqBody = l.peekBody(c)
+			}
+			respWriter = &accessLogWriter{ResponseWriter: c.Writer, max: conf.BodyMaxBytes}
+			c.Writer = respWriter
+		}
+		c.Next()
+
+		cost := time.Since(start)
+		status := c.Writer.Status()
+		slow := conf.SlowThreshold > 0 && cost > conf.SlowThreshold
+		if !slow && status < 400 && conf.SampleRate > 0 && conf.SampleRate < 1 && rand.Float64() >= conf.SampleRate {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.Int("status", status),
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.String("query", l.redactForm(query)),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user-agent", c.Request.UserAgent()),
+			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
+			zap.Duration("cost", cost),
+		}
+		if id := c.GetString(ctxKeyRequestID); id != "" {
+			fields = append(fields, zap.String("request_id", id))
+		}
+		if uid := c.GetInt64("uid"); uid > 0 {
+			fields = append(fields, zap.Int64("uid", uid))
+		}
+		if code, ok := (&Context{c}).ErrorCode(); ok {
+			fields = append(fields, zap.Int("error_code", code))
+		}
+		if stat := streamStatOf(c); stat != nil {
+			fields = append(fields, zap.String("stream", stat.Kind), zap.Int("stream_events", stat.Events), zap.Bool("stream_disconnected", stat.Disconnected))
+		}
+		if conf.Headers {
+			fields = append(fields, zap.Any("headers", l.headers(c)))
+		}
+		if reqBody != nil {
+			fields = append(fields, zap.String("request_body", l.redactBody(c.ContentType(), reqBody, conf.BodyMaxBytes)))
+		}
+		if respWriter != nil && streamStatOf(c) == nil && l.captureType(c.Writer.Header().Get("Content-Type")) {
+			fields = append(fields, zap.String("response_body", l.redactBody(c.Writer.Header().Get("Content-Type"), respWriter.body.Bytes(), conf.BodyMaxBytes)))
+		}
+
+		level := zapcore.InfoLevel
+		if slow {
+			level = zapcore.WarnLevel
+			fields = append(fields, zap.Bool("slow", true))
+		}
+		if ce := Logger.Check(level, path); ce != nil {
+			ce.Write(fields...)
+		}
+	}
+}
+
+func newAccessLogger(conf AccessLogConfig) *accessLogger {
+	if len(conf.BodyContentTypes) == 0 {
+		conf.BodyContentTypes = []string{gin.MIMEJSON, gin.MIMEPOSTForm, gin.MIMEPlain}
+	}
+	if len(conf.RedactFields) == 0 {
+		conf.RedactFields = []string{"password", "pwd", "token", "secret", "id_card", "idcard"}
+	}
+	if len(conf.RedactHeaders) == 0 {
+		conf.RedactHeaders = []string{"Authorization", "Cookie", InnerHeaderSign}
+	}
+	l := &accessLogger{conf: conf, skipPaths: make(map[string]bool), redactHeaders: make(map[string]bool)}
+	for _, val := range conf.SkipPaths {
+		if strings.HasSuffix(val, "*") {
+			l.skipPrefixes = append(l.skipPrefixes, strings.TrimSuffix(val, "*"))
+		} else {
+			l.skipPaths[val] = true
+		}
+	}
+	for _, val := range conf.RedactHeaders {
+		l.redactHeaders[strings.ToLower(val)] = true
+	}
+	fields := make([]string, 0, len(conf.RedactFields))
+	for _, val := range conf.RedactFields {
+		fields = append(fields, regexp.QuoteMeta(val))
+	}
+	names := strings.Join(fields, "|")
+	//按正则脱敏，被截断的json也能处理
+	l.jsonRegexp = regexp.MustCompile(`(?i)("(?:` + names + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	l.formRegexp = regexp.MustCompile(`(?i)((?:^|&)(?:` + names + `)=)[^&]*`)
+	return l
+}
+
+func (l *accessLogger) skip(path string) bool {
+	if l.skipPaths[path] {
+		return true
+	}
+	for _, prefix := range l.skipPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *accessLogger) captureType(contentType string) bool {
+	for _, val := range l.conf.BodyContentTypes {
+		if strings.HasPrefix(contentType, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// peekBody 读取请求体的前BodyMaxBytes+1个字节，不影响后续读取
+func (l *accessLogger) peekBody(c *gin.Context) []byte {
+	if cb, ok := c.Get(gin.BodyBytesKey); ok {
+		if raw, ok := cb.([]byte); ok {
+			return raw
+		}
+	}
+	buf := make([]byte, l.conf.BodyMaxBytes+1)
+	n, _ := io.ReadFull(c.Request.Body, buf)
+	buf = buf[:n]
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), c.Request.Body), c.Request.Body}
+	return buf
+}
+
+func (l *accessLogger) headers(c *gin.Context) map[string]string {
+	res := make(map[string]string, len(c.Request.Header))
+	for key, val := range c.Request.Header {
+		if l.redactHeaders[strings.ToLower(key)] {
+			res[key] = redactMask
+		} else {
+			res[key] = strings.Join(val, ",")
+		}
+	}
+	return res
+}
+
+// redactBody 脱敏并截断请求或响应体
+func (l *accessLogger) redactBody(contentType string, body []byte, max int) string {
+	truncated := len(body) > max
+	if truncated {
+		body = body[:max]
+	}
+	var res string
+	if strings.HasPrefix(contentType, gin.MIMEPOSTForm) {
+		res = l.redactForm(string(body))
+	} else {
+		res = l.jsonRegexp.ReplaceAllString(string(body), `${1}"`+redactMask+`"`)
+	}
+	if truncated {
+		res += "...(truncated)"
+	}
+	return res
+}
+
+func (l *accessLogger) redactForm(query string) string {
+	if query == "" {
+		return query
+	}
+	return l.formRegexp.ReplaceAllString(query, "${1}"+redactMask)
+}
+
+// accessLogWriter 记录响应体的前max+1个字节
+type accessLogWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	max  int
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *accessLogWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *accessLogWriter) capture(p []byte) {
+	if remain := w.max + 1 - w.body.Len(); remain > 0 {
+		if len(p) > remain {
+			p = p[:remain]
+		}
+		w.body.Write(p)
+	}
+}
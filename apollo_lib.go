@@ -8,12 +8,16 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"strings"
+	"sync"
 )
 
 var (
 	apolloConfigProject *storage.Config
 	apolloConfigDefault *storage.Config
 	ProjectName         string
+
+	configWatchLock sync.RWMutex
+	configWatchers  = make(map[string][]func(key string))
 )
 
 // Init 阿波罗客户端
@@ -243,6 +247,21 @@ func (a apolloChangeLister) OnChange(event *storage.ChangeEvent) {
 	if logChanged {
 		Logger.Info("重启logger")
 	}
+	//通知配置监听
+	configWatchLock.RLock()
+	defer configWatchLock.RUnlock()
+	for key := range event.Changes {
+		for _, fn := range configWatchers[key] {
+			fn(key)
+		}
+	}
+}
+
+// ConfigWatch 阿波罗配置key变化后回调fn，回调中通过ConfigVal等读取最新值
+func ConfigWatch(key string, fn func(key string)) {
+	configWatchLock.Lock()
+	defer configWatchLock.Unlock()
+	configWatchers[key] = append(configWatchers[key], fn)
 }
 
 func (a apolloChangeLister) OnNewestChange(event *storage.FullChangeEvent) {
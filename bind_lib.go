@@ -0,0 +1,423 @@
+package ginlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	ctxKeyJsonBody = "ginlib.json_body"
+)
+
+// FieldError 单个参数的校验错误
+type FieldError struct {
+	Field string
+	ErrorI18n
+}
+
+func (e FieldError) Unwrap() error {
+	return e.ErrorI18n
+}
+
+// FieldErrors 参数校验错误集合，JsonError会按字段渲染到data中
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, val := range e {
+		msgs = append(msgs, val.Error())
+	}
+	return strings.Join(msgs, ";")
+}
+
+// Unwrap 返回第一个字段错误，使errors.As(err, &ErrorI18n{})可以生效
+func (e FieldErrors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0].ErrorI18n
+}
+
+// Bind 将query、form、json body、路由参数、请求头按InputSources顺序合并绑定到结构体，填充默认值并执行校验
+// obj 必须是结构体指针，支持的tag:
+// form:"name" 参数名，未配置时依次使用json tag、字段名
+// default:"1" 参数未传递时的默认值
+// valid:"required;min=1;max=100" 校验规则，多个规则使用;分隔
+// 支持的校验规则: required、min、max、len、in(使用|分隔)、regex、mobile、email、idcard
+// regex规则编译后缓存，表达式错误时返回error
+func (c *Context) Bind(obj interface{}) error {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Bind的参数必须是结构体指针")
+	}
+	values, err := c.bindValues()
+	if err != nil {
+		return err
+	}
+	var errs FieldErrors
+	if err = bindStruct(rv.Elem(), values, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindValues 按参数查找顺序合并所有参数来源，先出现的来源优先
+func (c *Context) bindValues() (map[string][]string, error) {
+	values := make(map[string][]string)
+	for _, source := range c.inputSources() {
+		src, err := c.inputSourceAll(source)
+		if err != nil {
+			return nil, err
+		}
+		for key, val := range src {
+			if _, ok := values[key]; !ok && len(val) > 0 {
+				values[key] = val
+			}
+		}
+	}
+	return values, nil
+}
+
+// bodyBytes 读取请求体并缓存，保证请求体可以被多次读取
+func (c *Context) bodyBytes() ([]byte, error) {
+	if cb, ok := c.Get(gin.BodyBytesKey); ok {
+		if body, ok := cb.([]byte); ok {
+			return body, nil
+		}
+	}
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.Set(gin.BodyBytesKey, body)
+	return body, nil
+}
+
+// jsonBody 解析json请求体并缓存，非json请求返回nil
+func (c *Context) jsonBody() (map[string]interface{}, error) {
+	if cb, ok := c.Get(ctxKeyJsonBody); ok {
+		val, _ := cb.(map[string]interface{})
+		return val, nil
+	}
+	if c.ContentType() != gin.MIMEJSON {
+		return nil, nil
+	}
+	body, err := c.bodyBytes()
+	if err != nil {
+		return nil, err
+	}
+	var val map[string]interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err = dec.Decode(&val); err != nil {
+			return nil, err
+		}
+	}
+	c.Set(ctxKeyJsonBody, val)
+	return val, nil
+}
+
+// jsonValueStrs 将json值转换为字符串形式，对象和对象数组保留原始json
+func jsonValueStrs(val interface{}) []string {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				raw, _ := json.Marshal(v)
+				return []string{string(raw)}
+			}
+			res = append(res, jsonValueStrs(item)...)
+		}
+		return res
+	default:
+		raw, _ := json.Marshal(v)
+		return []string{string(raw)}
+	}
+}
+
+// bindStruct 绑定并校验字段，校验规则配置错误时返回error
+func bindStruct(rv reflect.Value, values map[string][]string, errs *FieldErrors) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		name := bindFieldName(field)
+		if name == "-" {
+			continue
+		}
+		//匿名结构体展开绑定
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("form") == "" {
+			if err := bindStruct(fv, values, errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		vals, provided := values[name]
+		if !provided || len(vals) == 0 || (len(vals) == 1 && vals[0] == "") {
+			provided = false
+			if def, ok := field.Tag.Lookup("default"); ok {
+				vals = []string{def}
+				provided = true
+			}
+		}
+		if provided {
+			if err := bindSetField(fv, vals); err != nil {
+				*errs = append(*errs, FieldError{name, ErrorI18nNew("参数%s格式错误", name)})
+				continue
+			}
+		}
+		fieldErr, err := bindValidate(name, fv, provided, field.Tag.Get("valid"))
+		if err != nil {
+			return err
+		}
+		if fieldErr != nil {
+			*errs = append(*errs, FieldError{name, *fieldErr})
+		}
+	}
+	return nil
+}
+
+func bindFieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("form"), ",")[0]; name != "" {
+		return name
+	}
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func bindSetField(fv reflect.Value, vals []string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return bindSetField(fv.Elem(), vals)
+	}
+	switch fv.Kind() {
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(vals[0]))
+			return nil
+		}
+		if len(vals) == 1 && strings.HasPrefix(vals[0], "[") {
+			return json.Unmarshal([]byte(vals[0]), fv.Addr().Interface())
+		}
+		if len(vals) == 1 {
+			vals = strings.Split(vals[0], ",")
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for idx, val := range vals {
+			if err := bindSetField(slice.Index(idx), []string{strings.TrimSpace(val)}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	case reflect.Interface:
+		fv.Set(reflect.ValueOf(vals[0]))
+		return nil
+	case reflect.Struct, reflect.Map:
+		return json.Unmarshal([]byte(vals[0]), fv.Addr().Interface())
+	default:
+		return bindSetScalar(fv, vals[0])
+	}
+}
+
+func bindSetScalar(fv reflect.Value, val string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		t, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(t)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		t, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(t)
+	case reflect.Float32, reflect.Float64:
+		t, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(t)
+	case reflect.Bool:
+		t, err := parseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(t)
+	default:
+		return fmt.Errorf("不支持的参数类型:%s", fv.Kind())
+	}
+	return nil
+}
+
+// bindValidate 执行valid标签中的校验规则，返回参数错误，规则配置错误时返回error
+func bindValidate(name string, fv reflect.Value, provided bool, rules string) (*ErrorI18n, error) {
+	if rules == "" {
+		return nil, nil
+	}
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			break
+		}
+		fv = fv.Elem()
+	}
+	for _, rule := range strings.Split(rules, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		ruleName, ruleArg := rule, ""
+		if idx := strings.Index(rule, "="); idx > -1 {
+			ruleName, ruleArg = rule[:idx], rule[idx+1:]
+		}
+		if ruleName == "required" {
+			if !provided || (fv.Kind() == reflect.String && strings.TrimSpace(fv.String()) == "") {
+				err := ErrorI18nNew("参数%s不能为空", name)
+				return &err, nil
+			}
+			continue
+		}
+		//未传递的参数不做其他校验
+		if !provided {
+			return nil, nil
+		}
+		if fieldErr, err := bindValidateRule(name, fv, ruleName, ruleArg); fieldErr != nil || err != nil {
+			return fieldErr, err
+		}
+	}
+	return nil, nil
+}
+
+// bindRegexps 已编译的regex校验规则，编译失败时缓存error
+var bindRegexps sync.Map
+
+type bindRegexp struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// bindRegexpGet 编译并缓存regex校验规则
+func bindRegexpGet(pattern string) (*regexp.Regexp, error) {
+	if val, ok := bindRegexps.Load(pattern); ok {
+		item := val.(bindRegexp)
+		return item.re, item.err
+	}
+	re, err := regexp.Compile(pattern)
+	bindRegexps.Store(pattern, bindRegexp{re: re, err: err})
+	return re, err
+}
+
+func bindValidateRule(name string, fv reflect.Value, ruleName, ruleArg string) (*ErrorI18n, error) {
+	var err ErrorI18n
+	switch ruleName {
+	case "min", "max", "len":
+		limit, e := strconv.ParseFloat(ruleArg, 64)
+		if e != nil {
+			return nil, fmt.Errorf("参数%s的校验规则%s配置错误:%w", name, ruleName, e)
+		}
+		size, isLen := bindValueSize(fv)
+		switch {
+		case ruleName == "min" && size < limit:
+			err = ErrorI18nNew(SumMu(isLen, "参数%s长度不能小于%v", "参数%s不能小于%v").(string), name, ruleArg)
+		case ruleName == "max" && size > limit:
+			err = ErrorI18nNew(SumMu(isLen, "参数%s长度不能大于%v", "参数%s不能大于%v").(string), name, ruleArg)
+		case ruleName == "len" && size != limit:
+			err = ErrorI18nNew("参数%s长度必须为%v", name, ruleArg)
+		default:
+			return nil, nil
+		}
+	case "in":
+		str := fmt.Sprintf("%v", fv.Interface())
+		for _, val := range strings.Split(ruleArg, "|") {
+			if val == str {
+				return nil, nil
+			}
+		}
+		err = ErrorI18nNew("参数%s取值不合法", name)
+	case "regex":
+		re, e := bindRegexpGet(ruleArg)
+		if e != nil {
+			return nil, fmt.Errorf("参数%s的校验规则regex配置错误:%w", name, e)
+		}
+		if re.MatchString(fmt.Sprintf("%v", fv.Interface())) {
+			return nil, nil
+		}
+		err = ErrorI18nNew("参数%s格式错误", name)
+	case "mobile", "email", "idcard":
+		str := fv.String()
+		valid := false
+		switch ruleName {
+		case "mobile":
+			valid = ValidMobile(str)
+		case "email":
+			valid = ValidEmail(str)
+		case "idcard":
+			citizenNo := []byte(str)
+			valid = IsValidCitizenNo(&citizenNo)
+		}
+		if valid {
+			return nil, nil
+		}
+		err = ErrorI18nNew("参数%s格式错误", name)
+	default:
+		return nil, fmt.Errorf("参数%s使用了未知的校验规则:%s", name, ruleName)
+	}
+	return &err, nil
+}
+
+// bindValueSize 获取用于min/max比较的值，字符串和切片返回长度
+func bindValueSize(fv reflect.Value) (size float64, isLen bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false
+	}
+	return 0, false
+}
@@ -0,0 +1,92 @@
+package ginlib
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ctxKeyBodyLimit = "ginlib.body_limit"
+)
+
+var (
+	ErrBodyTooLarge = BizErrorRegister(4131, "请求体大小不能超过%s", http.StatusRequestEntityTooLarge, zapcore.InfoLevel)
+)
+
+// BodyLimitConfig 请求体大小限制配置
+type BodyLimitConfig struct {
+	Default int64            //默认限制(字节)，0不限制
+	Routes  map[string]int64 //按路由模板设置限制，如"/upload": 100<<20，0不限制
+}
+
+// BodyLimitWare 限制请求体大小
+func BodyLimitWare(limit int64) gin.HandlerFunc {
+	return BodyLimitWareWithConfig(BodyLimitConfig{Default: limit})
+}
+
+// BodyLimitWareWithConfig 限制请求体大小，可按路由设置不同的限制，超出时返回ErrBodyTooLarge
+// Content-Length超出限制时直接返回，未知长度(chunked)的请求体先读取到内存再交给handler
+// 限制同样作用于DecompressWare解压后的大小
+func BodyLimitWareWithConfig(conf BodyLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := conf.Default
+		if val, ok := conf.Routes[c.FullPath()]; ok {
+			limit = val
+		}
+		if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		c.Set(ctxKeyBodyLimit, limit)
+		this := Context{c}
+		if c.Request.ContentLength > limit {
+			this.JsonError(ErrBodyTooLarge.New(uploadSizeStr(limit)))
+			c.Abort()
+			return
+		}
+		if c.Request.ContentLength < 0 {
+			data, err := readBodyLimit(c.Request.Body, limit)
+			if err != nil {
+				this.JsonError(err)
+				c.Abort()
+				return
+			}
+			setBody(c, data)
+		}
+		c.Next()
+	}
+}
+
+// readBodyLimit 读取请求体，超出limit时返回ErrBodyTooLarge
+func readBodyLimit(r io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, ErrBodyFormat.New()
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge.New(uploadSizeStr(limit))
+	}
+	return data, nil
+}
+
+// bodyLimit BodyLimitWare设置的限制，未设置时返回def
+func bodyLimit(c *gin.Context, def int64) int64 {
+	if val, ok := c.Get(ctxKeyBodyLimit); ok {
+		if limit, ok := val.(int64); ok && limit > 0 {
+			return limit
+		}
+	}
+	return def
+}
+
+// setBody 替换请求体并更新长度
+func setBody(c *gin.Context, data []byte) {
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	c.Request.ContentLength = int64(len(data))
+	c.Request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+}
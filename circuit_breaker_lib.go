@@ -0,0 +1,232 @@
+package ginlib
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota //关闭，正常放行
+	CircuitOpen                         //打开，直接拒绝
+	CircuitHalfOpen                     //半开，放行少量探测请求
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+var (
+	ErrCircuitOpen = BizErrorRegister(5030, "服务暂不可用,请稍后再试", http.StatusServiceUnavailable, zapcore.WarnLevel)
+
+	//metricCircuitState 熔断器状态，0关闭 1打开 2半开，<namespace>_circuit_breaker_state
+	metricCircuitState = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_state",
+		}, []string{"name"})
+	})
+	//metricCircuitRequests 经过熔断器的请求数，result为success、failure、rejected，<namespace>_circuit_breaker_requests_total
+	metricCircuitRequests = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_requests_total",
+		}, []string{"name", "result"})
+	})
+)
+
+// CircuitBreakerConfig 熔断器配置
+type CircuitBreakerConfig struct {
+	FailureThreshold int              //连续失败次数达到该值时打开，默认5
+	FailureRatio     float64          //Window内失败比例达到该值且请求数不少于MinRequests时打开，0不启用
+	MinRequests      int              //按比例熔断的最少请求数，默认20
+	Window           time.Duration    //失败比例的统计窗口，默认10秒
+	OpenTimeout      time.Duration    //打开后经过该时间进入半开，默认30秒
+	HalfOpenRequests int              //半开时放行的探测请求数，全部成功后关闭，默认1
+	IsFailure        func(error) bool //判断错误是否计为失败，默认除context.Canceled与业务错误外的错误
+}
+
+// CircuitBreaker 熔断器，下游持续失败时快速失败，OpenTimeout后放行探测请求，探测成功后恢复
+type CircuitBreaker struct {
+	name string
+	conf CircuitBreakerConfig
+
+	lock        sync.Mutex
+	state       CircuitState
+	failures    int //连续失败次数
+	windowStart time.Time
+	total       int
+	failed      int
+	openedAt    time.Time
+	probing     int //半开时已放行的探测请求数
+	probeOk     int //半开时成功的探测请求数
+}
+
+// NewCircuitBreaker 创建熔断器，name用于指标与日志
+func NewCircuitBreaker(name string, conf CircuitBreakerConfig) *CircuitBreaker {
+	if conf.FailureThreshold <= 0 {
+		conf.FailureThreshold = 5
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = 20
+	}
+	if conf.Window <= 0 {
+		conf.Window = 10 * time.Second
+	}
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = 30 * time.Second
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = 1
+	}
+	if conf.IsFailure == nil {
+		conf.IsFailure = circuitIsFailure
+	}
+	b := &CircuitBreaker{name: name, conf: conf, windowStart: time.Now()}
+	metricCircuitState.gauge().WithLabelValues(name).Set(float64(CircuitClosed))
+	return b
+}
+
+// circuitIsFailure 调用方取消与业务错误不计为下游故障
+func circuitIsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var i18nErr ErrorI18n
+	var bizErr BizError
+	var innerErr *InnerError
+	return !errors.As(err, &i18nErr) && !errors.As(err, &bizErr) && !errors.As(err, &innerErr)
+}
+
+// Do 通过熔断器执行fn，熔断器打开时不执行fn并返回ErrCircuitOpen
+func (b *CircuitBreaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			done(errors.New("panic"))
+			panic(e)
+		}
+	}()
+	err = fn()
+	done(err)
+	return err
+}
+
+// Allow 判断是否放行，放行时调用方需在调用结束后执行done(err)上报结果
+func (b *CircuitBreaker) Allow() (done func(err error), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.conf.OpenTimeout {
+		b.setState(CircuitHalfOpen)
+	}
+	switch b.state {
+	case CircuitOpen:
+		metricCircuitRequests.counter().WithLabelValues(b.name, "rejected").Inc()
+		return nil, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probing >= b.conf.HalfOpenRequests {
+			metricCircuitRequests.counter().WithLabelValues(b.name, "rejected").Inc()
+			return nil, ErrCircuitOpen
+		}
+		b.probing++
+	}
+	state := b.state
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.report(state, b.conf.IsFailure(err))
+		})
+	}, nil
+}
+
+// report 记录调用结果，state为放行时的状态
+func (b *CircuitBreaker) report(state CircuitState, failed bool) {
+	result := "success"
+	if failed {
+		result = "failure"
+	}
+	metricCircuitRequests.counter().WithLabelValues(b.name, result).Inc()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if state == CircuitHalfOpen {
+		//只处理本轮半开期间放行的探测请求
+		if b.state != CircuitHalfOpen {
+			return
+		}
+		if failed {
+			b.open()
+			return
+		}
+		b.probeOk++
+		if b.probeOk >= b.conf.HalfOpenRequests {
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= b.conf.Window {
+		b.windowStart, b.total, b.failed = now, 0, 0
+	}
+	b.total++
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.failed++
+	if b.failures >= b.conf.FailureThreshold ||
+		(b.conf.FailureRatio > 0 && b.total >= b.conf.MinRequests && float64(b.failed)/float64(b.total) >= b.conf.FailureRatio) {
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *CircuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	if Logger != nil {
+		Logger.Warn("熔断器状态变化", zap.String("name", b.name), zap.String("from", b.state.String()), zap.String("to", state.String()))
+	}
+	b.state = state
+	b.failures, b.total, b.failed, b.probing, b.probeOk = 0, 0, 0, 0, 0
+	b.windowStart = time.Now()
+	metricCircuitState.gauge().WithLabelValues(b.name).Set(float64(state))
+}
+
+// State 当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.conf.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,276 @@
+package ginlib
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// DecompressWare 解压Content-Encoding为gzip的请求体，解压后的大小受BodyLimitWare的限制，未设置时使用maxSize，默认10M
+// 解压失败返回ErrBodyFormat，超出限制返回ErrBodyTooLarge
+func DecompressWare(maxSize int64) gin.HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		if (encoding != EncodingGzip && encoding != "x-gzip") || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		this := Context{c}
+		gr, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			this.JsonError(ErrBodyFormat.New())
+			c.Abort()
+			return
+		}
+		data, err := readBodyLimit(gr, bodyLimit(c, maxSize))
+		gr.Close()
+		if err != nil {
+			this.JsonError(err)
+			c.Abort()
+			return
+		}
+		c.Request.Header.Del("Content-Encoding")
+		setBody(c, data)
+		c.Next()
+	}
+}
+
+// CompressConfig 响应压缩配置
+type CompressConfig struct {
+	Encodings    []string //支持的压缩方式，按优先级排列，默认br、gzip
+	MinSize      int      //响应体不小于该值时压缩，默认1024字节
+	ContentTypes []string //压缩的Content-Type，支持text/*这类通配，默认json、html、css、js、xml、纯文本与svg
+	GzipLevel    int      //默认gzip.DefaultCompression
+	BrotliLevel  int      //默认4，兼顾压缩率与速度
+}
+
+// CompressWare 按Accept-Encoding使用brotli或gzip压缩响应
+func CompressWare() gin.HandlerFunc {
+	return CompressWareWithConfig(CompressConfig{})
+}
+
+// CompressWareWithConfig 按Accept-Encoding使用brotli或gzip压缩响应
+// 先缓存MinSize字节，响应体小于MinSize、Content-Type不在列表中或已设置Content-Encoding时不压缩
+// 压缩时ETag改为弱校验，流式响应调用Flush时同步刷新压缩数据
+// 之后的中间件与handler中c.Writer.Size()为压缩前的长度，之前注册的中间件(如GinLogger)得到的是实际发送的压缩后长度
+func CompressWareWithConfig(conf CompressConfig) gin.HandlerFunc {
+	if len(conf.Encodings) == 0 {
+		conf.Encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+	if conf.MinSize <= 0 {
+		conf.MinSize = 1024
+	}
+	if len(conf.ContentTypes) == 0 {
+		conf.ContentTypes = []string{
+			"application/json", "application/javascript", "application/xml", "image/svg+xml",
+			"text/html", "text/css", "text/plain", "text/javascript", "text/xml",
+		}
+	}
+	if conf.GzipLevel == 0 {
+		conf.GzipLevel = gzip.DefaultCompression
+	}
+	if conf.BrotliLevel <= 0 {
+		conf.BrotliLevel = 4
+	}
+	gzipPool := &sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(ioutil.Discard, conf.GzipLevel)
+		return w
+	}}
+	brotliPool := &sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(ioutil.Discard, conf.BrotliLevel)
+	}}
+
+	return func(c *gin.Context) {
+		encoding := compressNegotiate(c.GetHeader("Accept-Encoding"), conf.Encodings)
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		writer := &compressWriter{ResponseWriter: c.Writer, conf: &conf, encoding: encoding}
+		c.Writer = writer
+		finished := false
+		defer func() {
+			//panic时恢复原来的Writer，未开始输出时丢弃已缓存的内容，由GinRecovery输出错误
+			if !finished && c.Writer == writer {
+				c.Writer = writer.ResponseWriter
+			}
+			if writer.w != nil {
+				writer.w.Close()
+				switch w := writer.w.(type) {
+				case *gzip.Writer:
+					gzipPool.Put(w)
+				case *brotli.Writer:
+					brotliPool.Put(w)
+				}
+				writer.w = nil
+			}
+		}()
+		writer.newWriter = func() io.WriteCloser {
+			if encoding == EncodingBrotli {
+				w := brotliPool.Get().(*brotli.Writer)
+				w.Reset(writer.ResponseWriter)
+				return w
+			}
+			w := gzipPool.Get().(*gzip.Writer)
+			w.Reset(writer.ResponseWriter)
+			return w
+		}
+		c.Next()
+		writer.decide(false)
+		c.Writer = writer.ResponseWriter
+		finished = true
+	}
+}
+
+// compressNegotiate 按Accept-Encoding的q值选择压缩方式，q值相同时按encodings的顺序
+func compressNegotiate(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	weights := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if val, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = val
+				}
+			}
+		}
+		weights[name] = q
+	}
+	res, best := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > best {
+			res, best = encoding, q
+		}
+	}
+	return res
+}
+
+// compressWriter 缓存响应体的前MinSize字节后决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	conf      *CompressConfig
+	encoding  string
+	newWriter func() io.WriteCloser
+	buf       []byte
+	size      int //handler写入的压缩前长度
+	decided   bool
+	w         io.WriteCloser //压缩时不为nil
+}
+
+// decide 决定是否压缩并输出已缓存的内容，force为true时不检查MinSize
+func (w *compressWriter) decide(force bool) {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if w.compressible(force) {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.w = w.newWriter()
+	}
+	if len(w.buf) > 0 {
+		w.write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *compressWriter) compressible(force bool) bool {
+	status := w.ResponseWriter.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if !force && len(w.buf) < w.conf.MinSize {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(header.Get("Content-Type"), ";")[0]))
+	if contentType == "" {
+		contentType = strings.ToLower(strings.Split(http.DetectContentType(w.buf), ";")[0])
+	}
+	for _, val := range w.conf.ContentTypes {
+		if val == contentType || (strings.HasSuffix(val, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(val, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.w != nil {
+		return w.w.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	w.size += len(p)
+	if w.decided {
+		return w.write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.conf.MinSize {
+		w.decide(false)
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.decide(false)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Size 压缩前的响应体长度，未输出时为-1
+func (w *compressWriter) Size() int {
+	if !w.Written() {
+		return -1
+	}
+	return w.size
+}
+
+func (w *compressWriter) Flush() {
+	w.decide(true)
+	if f, ok := w.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
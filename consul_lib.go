@@ -1,6 +1,7 @@
 package ginlib
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,6 +34,11 @@ func ConsulRegister(r *gin.Engine, prometheus bool) {
 	}
 	//添加健康检查路由
 	r.GET("/health", ipFilter, func(ctx *gin.Context) {
+		//停止过程中返回503，使consul尽快摘除流量
+		if !DefaultLifecycle.Ready() {
+			ctx.String(http.StatusServiceUnavailable, "stopping")
+			return
+		}
 		ctx.String(http.StatusOK, "success")
 		return
 	})
@@ -71,6 +77,14 @@ func ConsulRegister(r *gin.Engine, prometheus bool) {
 		Logger.Error("注册consul服务", zap.Error(err))
 		return
 	}
+	//停止时注销consul服务
+	DefaultLifecycle.OnStop("consul", StopPriorityRegistry, func(ctx context.Context) error {
+		//平滑重启时新进程使用相同的服务ID注册，不能注销
+		if DefaultLifecycle.Restarting() {
+			return nil
+		}
+		return consulClient.Agent().ServiceDeregister(registration.ID)
+	})
 }
 
 // LocalIP 获取本地ip
@@ -0,0 +1,305 @@
+package ginlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CorsConfig 跨域配置
+type CorsConfig struct {
+	AllowOrigins     []string               //允许的来源，如https://a.com、https://*.a.com(只匹配子域名)，*表示所有来源
+	AllowMethods     []string               //允许的请求方法，默认GET,POST,PUT,PATCH,DELETE,HEAD
+	AllowHeaders     []string               //允许的请求头，*表示允许预检请求中的所有请求头
+	ExposeHeaders    []string               //允许浏览器读取的响应头
+	AllowCredentials bool                   //是否允许携带cookie，为true时不返回*而是返回请求的Origin，来源包含*时忽略，需配置来源白名单
+	MaxAge           time.Duration          //预检结果的缓存时间，0不设置
+	Routes           map[string]*CorsConfig //按请求路径覆盖配置，以*结尾时按前缀匹配，未设置的字段使用默认值而非全局配置
+}
+
+// corsConfigJson 配置中的跨域配置，max_age使用10m、12h这类时长
+type corsConfigJson struct {
+	AllowOrigins     []string                   `json:"allow_origins"`
+	AllowMethods     []string                   `json:"allow_methods"`
+	AllowHeaders     []string                   `json:"allow_headers"`
+	ExposeHeaders    []string                   `json:"expose_headers"`
+	AllowCredentials bool                       `json:"allow_credentials"`
+	MaxAge           string                     `json:"max_age"`
+	Routes           map[string]*corsConfigJson `json:"routes"`
+}
+
+func (j *corsConfigJson) config() (*CorsConfig, error) {
+	conf := &CorsConfig{
+		AllowOrigins:     j.AllowOrigins,
+		AllowMethods:     j.AllowMethods,
+		AllowHeaders:     j.AllowHeaders,
+		ExposeHeaders:    j.ExposeHeaders,
+		AllowCredentials: j.AllowCredentials,
+	}
+	if j.MaxAge != "" {
+		maxAge, err := time.ParseDuration(j.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("跨域配置max_age格式错误:%w", err)
+		}
+		conf.MaxAge = maxAge
+	}
+	for route, val := range j.Routes {
+		if val == nil {
+			continue
+		}
+		routeConf, err := val.config()
+		if err != nil {
+			return nil, err
+		}
+		if conf.Routes == nil {
+			conf.Routes = make(map[string]*CorsConfig)
+		}
+		conf.Routes[route] = routeConf
+	}
+	return conf, nil
+}
+
+// ParseCorsConfig 解析json格式的跨域配置
+// {"allow_origins":["https://*.a.com"],"allow_credentials":true,"max_age":"12h","routes":{"/open/*":{"allow_origins":["*"]}}}
+func ParseCorsConfig(raw string) (CorsConfig, error) {
+	item := &corsConfigJson{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), item); err != nil {
+		return CorsConfig{}, fmt.Errorf("跨域配置格式错误:%w", err)
+	}
+	conf, err := item.config()
+	if err != nil {
+		return CorsConfig{}, err
+	}
+	return *conf, nil
+}
+
+// corsRule 预处理后的跨域配置
+type corsRule struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []string //来源通配，去掉*后的scheme://.a.com或.a.com
+	methods     map[string]bool
+	methodsStr  string
+	anyHeader   bool
+	headersStr  string
+	exposeStr   string
+	credentials bool
+	maxAge      string
+}
+
+func newCorsRule(conf CorsConfig) *corsRule {
+	if len(conf.AllowMethods) == 0 {
+		conf.AllowMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+	}
+	r := &corsRule{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		exposeStr:   strings.Join(conf.ExposeHeaders, ", "),
+		credentials: conf.AllowCredentials,
+	}
+	for _, val := range conf.AllowOrigins {
+		val = strings.ToLower(strings.TrimSpace(val))
+		if val == "*" {
+			r.anyOrigin = true
+		} else if idx := strings.Index(val, "*."); idx >= 0 {
+			r.wildcards = append(r.wildcards, val[:idx]+val[idx+1:])
+		} else if val != "" {
+			r.origins[strings.TrimRight(val, "/")] = true
+		}
+	}
+	methods := make([]string, 0, len(conf.AllowMethods))
+	for _, val := range conf.AllowMethods {
+		val = strings.ToUpper(strings.TrimSpace(val))
+		r.methods[val] = true
+		methods = append(methods, val)
+	}
+	r.methodsStr = strings.Join(methods, ", ")
+	for _, val := range conf.AllowHeaders {
+		if strings.TrimSpace(val) == "*" {
+			r.anyHeader = true
+		}
+	}
+	r.headersStr = strings.Join(conf.AllowHeaders, ", ")
+	if r.anyOrigin && r.credentials {
+		//允许所有来源携带cookie等同于关闭同源限制，任意网站都可以读取用户数据
+		log.Println("跨域配置允许所有来源时不能携带cookie，已忽略AllowCredentials")
+		r.credentials = false
+	}
+	if conf.MaxAge > 0 {
+		r.maxAge = strconv.Itoa(int(conf.MaxAge.Seconds()))
+	}
+	return r
+}
+
+// allowOrigin 来源是否允许
+func (r *corsRule) allowOrigin(origin string) bool {
+	if r.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if r.origins[origin] {
+		return true
+	}
+	scheme, host := "", origin
+	if idx := strings.Index(origin, "://"); idx >= 0 {
+		scheme, host = origin[:idx+3], origin[idx+3:]
+	}
+	for _, val := range r.wildcards {
+		//https://.a.com 匹配 https://x.a.com，.a.com 匹配任意scheme
+		wildScheme, suffix := "", val
+		if idx := strings.Index(val, "://"); idx >= 0 {
+			wildScheme, suffix = val[:idx+3], val[idx+3:]
+		}
+		if (wildScheme == "" || wildScheme == scheme) && strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type corsState struct {
+	rule   *corsRule
+	routes map[string]*corsRule
+}
+
+// CorsPolicy 跨域处理，配置可在运行中替换
+type CorsPolicy struct {
+	state atomic.Value
+}
+
+// NewCorsPolicy 创建跨域处理
+func NewCorsPolicy(conf CorsConfig) *CorsPolicy {
+	p := &CorsPolicy{}
+	p.SetConfig(conf)
+	return p
+}
+
+// CorsWithConfig 按配置处理跨域请求
+func CorsWithConfig(conf CorsConfig) gin.HandlerFunc {
+	return NewCorsPolicy(conf).Ware()
+}
+
+// SetConfig 替换跨域配置，并发安全
+func (p *CorsPolicy) SetConfig(conf CorsConfig) {
+	state := &corsState{rule: newCorsRule(conf), routes: make(map[string]*corsRule, len(conf.Routes))}
+	for route, val := range conf.Routes {
+		if val != nil {
+			state.routes[route] = newCorsRule(*val)
+		}
+	}
+	p.state.Store(state)
+}
+
+// LoadIni 从ini中读取json格式的跨域配置，key格式为section.key
+func (p *CorsPolicy) LoadIni(key string) error {
+	conf, err := ParseCorsConfig(Ini_Str(key))
+	if err != nil {
+		return err
+	}
+	p.SetConfig(conf)
+	return nil
+}
+
+// WatchConfig 从阿波罗读取json格式的跨域配置，配置变化后自动更新，更新失败时保留原配置
+func (p *CorsPolicy) WatchConfig(key string) error {
+	load := func(key string) error {
+		conf, err := ParseCorsConfig(ConfigVal(key))
+		if err != nil {
+			return err
+		}
+		p.SetConfig(conf)
+		Logger.Info("跨域配置已更新", zap.String("key", key))
+		return nil
+	}
+	ConfigWatch(key, func(key string) {
+		if err := load(key); err != nil {
+			Logger.Error("跨域配置更新失败", zap.String("key", key), zap.Error(err))
+		}
+	})
+	return load(key)
+}
+
+// rule 按请求路径获取配置，精确匹配优先，其次为最长的前缀
+func (p *CorsPolicy) rule(path string) *corsRule {
+	state := p.state.Load().(*corsState)
+	if r, ok := state.routes[path]; ok {
+		return r
+	}
+	var res *corsRule
+	prefixLen := -1
+	for route, r := range state.routes {
+		if strings.HasSuffix(route, "*") && strings.HasPrefix(path, strings.TrimSuffix(route, "*")) && len(route) > prefixLen {
+			res, prefixLen = r, len(route)
+		}
+	}
+	if res != nil {
+		return res
+	}
+	return state.rule
+}
+
+// Ware 跨域中间件，需在路由之前通过Use注册，未注册OPTIONS路由时预检请求也能处理
+// 来源不允许时不返回跨域响应头，预检请求返回403；预检请求返回204后不再执行后续handler
+func (p *CorsPolicy) Ware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		rule := p.rule(c.Request.URL.Path)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		header := c.Writer.Header()
+		if !rule.anyOrigin {
+			header.Add("Vary", "Origin")
+		}
+		if !rule.allowOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if rule.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if rule.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if rule.exposeStr != "" {
+				header.Set("Access-Control-Expose-Headers", rule.exposeStr)
+			}
+			c.Next()
+			return
+		}
+
+		if !rule.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", rule.methodsStr)
+		if reqHeaders := c.GetHeader("Access-Control-Request-Headers"); rule.anyHeader && reqHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", reqHeaders)
+		} else if rule.headersStr != "" {
+			header.Set("Access-Control-Allow-Headers", rule.headersStr)
+		}
+		if rule.maxAge != "" {
+			header.Set("Access-Control-Max-Age", rule.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
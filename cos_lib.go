@@ -0,0 +1,177 @@
+package ginlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CosConfig 腾讯云cos配置
+type CosConfig struct {
+	BucketName string //存储桶名称，不含appid
+	AppId      string
+	Region     string
+	SecretId   string
+	SecretKey  string
+}
+
+// CosConfigFromIni 从ini的[tx]中读取cos配置
+func CosConfigFromIni() CosConfig {
+	return CosConfig{
+		BucketName: Ini_Str("tx.cos_bucketname"),
+		AppId:      Ini_Str("tx.cos_appid"),
+		Region:     Ini_Str("tx.cos_region"),
+		SecretId:   Ini_Str("tx.cos_secretId"),
+		SecretKey:  Ini_Str("tx.cos_secretKey"),
+	}
+}
+
+// CosConfigGet 从阿波罗读取cos配置，key为cos.<name>.bucket、appid、region、secret_id、secret_key
+func CosConfigGet(name string) CosConfig {
+	return CosConfig{
+		BucketName: ConfigVal(fmt.Sprintf("cos.%s.bucket", name)),
+		AppId:      ConfigVal(fmt.Sprintf("cos.%s.appid", name)),
+		Region:     ConfigVal(fmt.Sprintf("cos.%s.region", name)),
+		SecretId:   ConfigVal(fmt.Sprintf("cos.%s.secret_id", name)),
+		SecretKey:  ConfigVal(fmt.Sprintf("cos.%s.secret_key", name)),
+	}
+}
+
+// InitTxCloud 使用ini的[tx]配置初始化腾讯云cos，并设置为DefaultStorage
+func InitTxCloud() {
+	conf := CosConfigFromIni()
+	log.Println("初始化腾讯云cos, bucket:", conf.BucketName, "region:", conf.Region)
+	DefaultStorage = NewCosStorage(conf)
+}
+
+// CosStorage 腾讯云cos存储
+type CosStorage struct {
+	conf   CosConfig
+	client *cos.Client
+}
+
+// NewCosStorage 创建腾讯云cos存储
+func NewCosStorage(conf CosConfig) *CosStorage {
+	bucket := conf.BucketName
+	if conf.AppId != "" && !strings.HasSuffix(bucket, "-"+conf.AppId) {
+		bucket += "-" + conf.AppId
+	}
+	client := cos.NewClient(&cos.BaseURL{BucketURL: cos.NewBucketURL(bucket, conf.Region, true)}, &http.Client{
+		Transport: &cos.AuthorizationTransport{
+			SecretID:  conf.SecretId,
+			SecretKey: conf.SecretKey,
+		},
+	})
+	return &CosStorage{conf: conf, client: client}
+}
+
+// Client 获取cos客户端，用于Storage未覆盖的功能
+func (s *CosStorage) Client() *cos.Client {
+	return s.client
+}
+
+func (s *CosStorage) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	header := &cos.ObjectPutHeaderOptions{ContentType: opts.ContentType}
+	if opts.Size >= 0 {
+		header.ContentLength = int(opts.Size)
+	} else {
+		//cos要求非内存reader必须指定长度
+		switch r.(type) {
+		case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		default:
+			raw, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			r = bytes.NewReader(raw)
+		}
+	}
+	_, err := s.client.Object.Put(ctx, cosKey(key), r, &cos.ObjectPutOptions{ObjectPutHeaderOptions: header})
+	return err
+}
+
+func (s *CosStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.Object.Get(ctx, cosKey(key), nil)
+	if err != nil {
+		return nil, cosError(err)
+	}
+	return resp.Body, nil
+}
+
+func (s *CosStorage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Object.Delete(ctx, cosKey(key))
+	if err = cosError(err); err == ErrObjectNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *CosStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := s.client.Object.Head(ctx, cosKey(key), nil)
+	if err != nil {
+		return ObjectInfo{}, cosError(err)
+	}
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:         key,
+		Size:        size,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		ModTime:     modTime,
+	}, nil
+}
+
+func (s *CosStorage) Presign(ctx context.Context, key string, method string, expire time.Duration) (string, error) {
+	u, err := s.client.Object.GetPresignedURL(ctx, strings.ToUpper(method), cosKey(key), s.conf.SecretId, s.conf.SecretKey, expire, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *CosStorage) List(ctx context.Context, prefix, marker string, limit int) (items []ObjectInfo, nextMarker string, err error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	res, _, err := s.client.Bucket.Get(ctx, &cos.BucketGetOptions{Prefix: cosKey(prefix), Marker: marker, MaxKeys: limit})
+	if err != nil {
+		return nil, "", err
+	}
+	for _, val := range res.Contents {
+		modTime, _ := time.Parse(time.RFC3339, val.LastModified)
+		items = append(items, ObjectInfo{
+			Key:     val.Key,
+			Size:    int64(val.Size),
+			ETag:    strings.Trim(val.ETag, `"`),
+			ModTime: modTime,
+		})
+	}
+	if res.IsTruncated {
+		nextMarker = res.NextMarker
+		if nextMarker == "" && len(items) > 0 {
+			nextMarker = items[len(items)-1].Key
+		}
+	}
+	return items, nextMarker, nil
+}
+
+// cosKey cos的key不以/开头
+func cosKey(key string) string {
+	return strings.TrimLeft(key, "/")
+}
+
+func cosError(err error) error {
+	if cos.IsNotFoundError(err) {
+		return ErrObjectNotFound
+	}
+	return err
+}
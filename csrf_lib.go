@@ -0,0 +1,179 @@
+package ginlib
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ctxKeyCsrfToken = "ginlib.csrf_token"
+	ctxKeyCsrfIssue = "ginlib.csrf_issue"
+)
+
+var (
+	ErrCsrf = BizErrorRegister(4031, "请求已失效,请刷新页面后重试", http.StatusForbidden, zapcore.InfoLevel)
+)
+
+// CsrfConfig CSRF防护配置
+type CsrfConfig struct {
+	Secret      string                //签名密钥，设置后token带绑定uid的HMAC签名，子域名写入的其他用户的token无法通过校验，未登录时uid为0
+	CookieName  string                //默认csrf_token
+	HeaderName  string                //默认X-CSRF-Token
+	FormField   string                //默认_csrf
+	CookiePath  string                //默认/
+	Domain      string                //cookie的域名
+	Secure      bool                  //cookie是否只通过https发送
+	SameSite    http.SameSite         //默认Lax
+	MaxAge      time.Duration         //cookie有效期，默认12小时
+	ExemptPaths []string              //不校验的请求路径，以*结尾时按前缀匹配，如/api/*
+	Exempt      func(c *Context) bool //自定义不校验的请求，如使用Authorization头认证的接口
+}
+
+// CsrfWare 双提交cookie方式的CSRF防护，设置Secret时需放在AuthWare之后，登录状态变化后token失效并重新下发
+// 安全方法(GET/HEAD/OPTIONS/TRACE)的请求在cookie中没有有效token时下发token，页面通过c.CsrfToken()获取
+// 其他方法需通过请求头或表单字段提交与cookie一致的token，否则返回ErrCsrf
+// 设置Secret时，登录、退出接口需在输出响应前调用c.CsrfRefresh按新的uid下发token，否则登录后的首个非安全请求会被拒绝
+func CsrfWare(conf CsrfConfig) gin.HandlerFunc {
+	if conf.CookieName == "" {
+		conf.CookieName = "csrf_token"
+	}
+	if conf.HeaderName == "" {
+		conf.HeaderName = "X-CSRF-Token"
+	}
+	if conf.FormField == "" {
+		conf.FormField = "_csrf"
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	if conf.SameSite == 0 {
+		conf.SameSite = http.SameSiteLaxMode
+	}
+	if conf.MaxAge <= 0 {
+		conf.MaxAge = 12 * time.Hour
+	}
+	return func(c *gin.Context) {
+		this := Context{c}
+		if csrfExempt(&this, conf) {
+			c.Next()
+			return
+		}
+		//按uid生成并下发token
+		issue := func(uid int64) (string, error) {
+			token, err := csrfNewToken(conf.Secret, uid)
+			if err != nil {
+				return "", err
+			}
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     conf.CookieName,
+				Value:    token,
+				Path:     conf.CookiePath,
+				Domain:   conf.Domain,
+				MaxAge:   int(conf.MaxAge.Seconds()),
+				Secure:   conf.Secure,
+				HttpOnly: false, //前端需读取cookie后放入请求头
+				SameSite: conf.SameSite,
+			})
+			c.Set(ctxKeyCsrfToken, token)
+			return token, nil
+		}
+		c.Set(ctxKeyCsrfIssue, issue)
+
+		uid := c.GetInt64("uid")
+		token, _ := c.Cookie(conf.CookieName)
+		valid := token != "" && csrfVerify(conf.Secret, uid, token)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			if !valid {
+				if _, err := issue(uid); err != nil {
+					this.Log().Error("生成csrf token失败", zap.Error(err))
+					this.JsonError(ErrSystem.New())
+					c.Abort()
+					return
+				}
+			} else {
+				c.Set(ctxKeyCsrfToken, token)
+			}
+			c.Next()
+			return
+		}
+
+		submitted := c.GetHeader(conf.HeaderName)
+		if submitted == "" {
+			submitted = c.PostForm(conf.FormField)
+		}
+		if !valid || submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			this.JsonError(ErrCsrf.New())
+			c.Abort()
+			return
+		}
+		c.Set(ctxKeyCsrfToken, token)
+		c.Next()
+	}
+}
+
+func csrfExempt(c *Context, conf CsrfConfig) bool {
+	path := c.Request.URL.Path
+	for _, val := range conf.ExemptPaths {
+		if val == path || (strings.HasSuffix(val, "*") && strings.HasPrefix(path, strings.TrimSuffix(val, "*"))) {
+			return true
+		}
+	}
+	return conf.Exempt != nil && conf.Exempt(c)
+}
+
+// csrfNewToken 生成随机token，设置secret时附加对uid|token的签名，随机数生成失败时返回错误
+func csrfNewToken(secret string, uid int64) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	if secret == "" {
+		return token, nil
+	}
+	return token + "." + csrfSign(secret, uid, token), nil
+}
+
+func csrfVerify(secret string, uid int64, token string) bool {
+	if secret == "" {
+		return true
+	}
+	idx := strings.LastIndex(token, ".")
+	if idx <= 0 {
+		return false
+	}
+	return hmac.Equal([]byte(token[idx+1:]), []byte(csrfSign(secret, uid, token[:idx])))
+}
+
+func csrfSign(secret string, uid int64, token string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(uid, 10) + "|" + token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CsrfToken 当前请求的CSRF token，用于页面表单的_csrf字段或meta标签
+func (c *Context) CsrfToken() string {
+	return c.GetString(ctxKeyCsrfToken)
+}
+
+// CsrfRefresh 登录或退出后按新的uid(退出时为0)重新下发CSRF token，需在输出响应前调用，未使用CsrfWare时忽略
+func (c *Context) CsrfRefresh(uid int64) (string, error) {
+	val, ok := c.Get(ctxKeyCsrfIssue)
+	if !ok {
+		return "", nil
+	}
+	return val.(func(uid int64) (string, error))(uid)
+}
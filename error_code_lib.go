@@ -0,0 +1,115 @@
+package ginlib
+
+import (
+	"fmt"
+	"github.com/beego/i18n"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// BizError 业务错误定义，将错误码与i18n编码、http状态码、日志级别绑定
+type BizError struct {
+	Code       int
+	I18nCode   string
+	HttpStatus int
+	Level      zapcore.Level
+}
+
+var (
+	bizErrorLock  sync.RWMutex
+	bizErrorCodes = make(map[int]BizError)
+	bizErrorI18ns = make(map[string]BizError)
+)
+
+// 内置业务错误码
+var (
+	ErrFail       = BizErrorRegister(1, "操作失败", http.StatusBadRequest, zapcore.InfoLevel)
+	ErrParam      = BizErrorRegister(4000, "参数错误", http.StatusBadRequest, zapcore.InfoLevel)
+	ErrBodyFormat = BizErrorRegister(4001, "请求体格式错误", http.StatusBadRequest, zapcore.InfoLevel)
+	ErrSystem     = BizErrorRegister(5000, "系统异常", http.StatusInternalServerError, zapcore.ErrorLevel)
+	ErrNotLogin   = BizErrorRegister(5003, "请先登录", http.StatusUnauthorized, zapcore.DebugLevel)
+)
+
+// BizErrorRegister 注册业务错误码，错误码或i18n编码重复注册会panic
+// 通常在包级别变量中定义: var ErrOrderNotFound = ginlib.BizErrorRegister(10001, "订单不存在", http.StatusNotFound, zapcore.InfoLevel)
+func BizErrorRegister(code int, i18nCode string, httpStatus int, level zapcore.Level) BizError {
+	bizErrorLock.Lock()
+	defer bizErrorLock.Unlock()
+	if old, ok := bizErrorCodes[code]; ok {
+		panic(fmt.Sprintf("业务错误码%d已被%s注册", code, old.I18nCode))
+	}
+	if old, ok := bizErrorI18ns[i18nCode]; ok {
+		panic(fmt.Sprintf("i18n编码%s已被错误码%d注册", i18nCode, old.Code))
+	}
+	b := BizError{Code: code, I18nCode: i18nCode, HttpStatus: httpStatus, Level: level}
+	bizErrorCodes[code] = b
+	bizErrorI18ns[i18nCode] = b
+	return b
+}
+
+// BizErrorGet 根据错误码获取业务错误定义
+func BizErrorGet(code int) (b BizError, exist bool) {
+	bizErrorLock.RLock()
+	defer bizErrorLock.RUnlock()
+	b, exist = bizErrorCodes[code]
+	return
+}
+
+// bizErrorByI18n 根据i18n编码获取业务错误定义
+func bizErrorByI18n(i18nCode string) (b BizError, exist bool) {
+	bizErrorLock.RLock()
+	defer bizErrorLock.RUnlock()
+	b, exist = bizErrorI18ns[i18nCode]
+	return
+}
+
+// New 创建该业务错误，args为i18n格式化参数
+func (b BizError) New(args ...interface{}) ErrorI18n {
+	return ErrorI18n{i18nCode: b.I18nCode, args: args, code: b.Code}
+}
+
+func (b BizError) Error() string {
+	return i18n.Tr("en", b.I18nCode)
+}
+
+// BizErrorDoc 错误码文档
+type BizErrorDoc struct {
+	Code       int               `json:"code"`
+	I18nCode   string            `json:"i18n_code"`
+	HttpStatus int               `json:"http_status"`
+	Level      string            `json:"level"`
+	Messages   map[string]string `json:"messages"` //key为语言，value为该语言的错误信息
+}
+
+// BizErrorCatalog 导出所有已注册的错误码及其在已加载语言中的错误信息，按错误码排序
+func BizErrorCatalog() []BizErrorDoc {
+	bizErrorLock.RLock()
+	docs := make([]BizErrorDoc, 0, len(bizErrorCodes))
+	for _, val := range bizErrorCodes {
+		messages := make(map[string]string)
+		for _, lang := range i18n.ListLangs() {
+			messages[lang] = i18n.Tr(lang, val.I18nCode)
+		}
+		docs = append(docs, BizErrorDoc{
+			Code:       val.Code,
+			I18nCode:   val.I18nCode,
+			HttpStatus: val.HttpStatus,
+			Level:      val.Level.String(),
+			Messages:   messages,
+		})
+	}
+	bizErrorLock.RUnlock()
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Code < docs[j].Code
+	})
+	return docs
+}
+
+// BizErrorCatalogHandler 输出错误码文档的路由，供客户端团队获取错误码清单
+func BizErrorCatalogHandler(c *gin.Context) {
+	this := Context{c}
+	this.JsonSucc(BizErrorCatalog())
+}
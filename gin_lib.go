@@ -1,24 +1,15 @@
 package ginlib
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"go.uber.org/zap"
 	"log"
 	"net"
 	"net/http"
-	"net/http/httputil"
-	"os"
-	"os/signal"
-	"runtime/debug"
 	"strconv"
 	"strings"
-	"syscall"
-	"time"
 )
 
 // Context 自定义包装gin上下文
@@ -26,6 +17,10 @@ type Context struct {
 	*gin.Context
 }
 
+const (
+	ctxKeyInputErrors = "ginlib.input_errors"
+)
+
 type GinJsonResp struct {
 	ErrorCode    int         `json:"error_code"`
 	ErrorMessage string      `json:"error_message"`
@@ -59,17 +54,21 @@ func (c *Context) JsonFail(msg string, datas ...interface{}) {
 	if len(datas) > 0 {
 		data = datas[0]
 	}
-	c.JsonReturn(1, data, msg)
+	c.JsonReturn(ErrFail.Code, data, msg)
 }
 
+// JsonReturn 通过当前请求的渲染器返回数据，默认输出GinJsonResp结构
+// code为已注册的业务错误码时使用其http状态码
 func (c *Context) JsonReturn(code int, data interface{}, msg string) {
-	c.JSON(http.StatusOK, GinJsonResp{
+	resp := RenderResp{
 		ErrorCode:    code,
 		ErrorMessage: msg,
 		Data:         data,
-		MsgCode:      "",
-		Lang:         "",
-	})
+	}
+	if b, ok := BizErrorGet(code); ok {
+		resp.HttpStatus = b.HttpStatus
+	}
+	c.JsonRender(resp)
 }
 
 func (c *Context) InputStr(key string, defs ...string) string {
@@ -77,247 +76,286 @@ func (c *Context) InputStr(key string, defs ...string) string {
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
-	}
-	if val == "" {
+	val, exist := c.inputRaw(key)
+	if !exist {
 		return def
 	}
 	return val
 }
 
 func (c *Context) InputInt(key string, defs ...int) int {
+	t, _ := c.InputIntE(key, defs...)
+	return t
+}
+
+func (c *Context) InputInt32(key string, defs ...int32) int32 {
+	t, _ := c.InputInt32E(key, defs...)
+	return t
+}
+
+func (c *Context) InputInt64(key string, defs ...int64) int64 {
+	t, _ := c.InputInt64E(key, defs...)
+	return t
+}
+
+func (c *Context) InputFloat32(key string, defs ...float32) float32 {
+	t, _ := c.InputFloat32E(key, defs...)
+	return t
+}
+
+func (c *Context) InputFloat64(key string, defs ...float64) float64 {
+	t, _ := c.InputFloat64E(key, defs...)
+	return t
+}
+
+func (c *Context) InputBool(key string, defs ...bool) bool {
+	t, _ := c.InputBoolE(key, defs...)
+	return t
+}
+
+// InputIntE 获取int参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputIntE(key string, defs ...int) (int, error) {
 	def := 0
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, inputFormatError(key)
 	}
-	t, _ := strconv.Atoi(val)
-
-	return t
+	return t, nil
 }
 
-func (c *Context) InputInt32(key string, defs ...int32) int32 {
+// InputInt32E 获取int32参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputInt32E(key string, defs ...int32) (int32, error) {
 	def := int32(0)
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := strconv.ParseInt(val, 10, 32)
+	if err != nil {
+		return 0, inputFormatError(key)
 	}
-	t, _ := strconv.ParseInt(val, 10, 32)
-
-	return int32(t)
+	return int32(t), nil
 }
 
-func (c *Context) InputInt64(key string, defs ...int64) int64 {
+// InputInt64E 获取int64参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputInt64E(key string, defs ...int64) (int64, error) {
 	def := int64(0)
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, inputFormatError(key)
 	}
-	t, _ := strconv.ParseInt(val, 10, 64)
-
-	return t
+	return t, nil
 }
 
-func (c *Context) InputFloat32(key string, defs ...float32) float32 {
+// InputFloat32E 获取float32参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputFloat32E(key string, defs ...float32) (float32, error) {
 	var def float32
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := strconv.ParseFloat(val, 32)
+	if err != nil {
+		return 0, inputFormatError(key)
 	}
-	t, _ := strconv.ParseFloat(val, 32)
-
-	return float32(t)
+	return float32(t), nil
 }
 
-func (c *Context) InputFloat64(key string, defs ...float64) float64 {
+// InputFloat64E 获取float64参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputFloat64E(key string, defs ...float64) (float64, error) {
 	var def float64
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, inputFormatError(key)
 	}
-	t, _ := strconv.ParseFloat(val, 64)
-
-	return t
+	return t, nil
 }
 
-func (c *Context) InputBool(key string, defs ...bool) bool {
+// InputBoolE 获取bool参数，与Bind相同支持1/true/yes/on等写法，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputBoolE(key string, defs ...bool) (bool, error) {
 	var def bool
 	if len(defs) > 0 {
 		def = defs[0]
 	}
-	val := c.Query(key)
-	if val == "" {
-		val = c.PostForm(key)
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
 	}
-	if val == "" {
-		return def
+	t, err := parseBool(val)
+	if err != nil {
+		return false, inputFormatError(key)
 	}
-	t, _ := strconv.ParseBool(val)
+	return t, nil
+}
+
+// MustInputStr 获取必传的string参数，未传递时记录到请求的参数错误中
+func (c *Context) MustInputStr(key string) string {
+	val, exist := c.inputRaw(key)
+	c.inputMust(key, exist, nil)
+	return val
+}
+
+// MustInputInt 获取必传的int参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputInt(key string) int {
+	t, err := c.InputIntE(key)
+	c.inputMust(key, c.inputExist(key), err)
+	return t
+}
+
+// MustInputInt32 获取必传的int32参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputInt32(key string) int32 {
+	t, err := c.InputInt32E(key)
+	c.inputMust(key, c.inputExist(key), err)
+	return t
+}
+
+// MustInputInt64 获取必传的int64参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputInt64(key string) int64 {
+	t, err := c.InputInt64E(key)
+	c.inputMust(key, c.inputExist(key), err)
+	return t
+}
+
+// MustInputFloat32 获取必传的float32参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputFloat32(key string) float32 {
+	t, err := c.InputFloat32E(key)
+	c.inputMust(key, c.inputExist(key), err)
+	return t
+}
+
+// MustInputFloat64 获取必传的float64参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputFloat64(key string) float64 {
+	t, err := c.InputFloat64E(key)
+	c.inputMust(key, c.inputExist(key), err)
+	return t
+}
 
+// MustInputBool 获取必传的bool参数，未传递或格式错误时记录到请求的参数错误中
+func (c *Context) MustInputBool(key string) bool {
+	t, err := c.InputBoolE(key)
+	c.inputMust(key, c.inputExist(key), err)
 	return t
 }
 
+// InputErrorAdd 记录一个参数错误，可配合InputErrors统一返回
+func (c *Context) InputErrorAdd(err error) {
+	if err == nil {
+		return
+	}
+	var errs FieldErrors
+	if val, ok := c.Get(ctxKeyInputErrors); ok {
+		errs = val.(FieldErrors)
+	}
+	var fieldErr FieldError
+	var fieldErrs FieldErrors
+	switch {
+	case errors.As(err, &fieldErrs):
+		errs = append(errs, fieldErrs...)
+	case errors.As(err, &fieldErr):
+		errs = append(errs, fieldErr)
+	default:
+		errs = append(errs, FieldError{"", ErrorI18nNew(err.Error())})
+	}
+	c.Set(ctxKeyInputErrors, errs)
+}
+
+// InputErrors 返回当前请求记录的所有参数错误，没有错误时返回nil
+// 返回的错误可直接交给JsonError按字段渲染
+func (c *Context) InputErrors() error {
+	if val, ok := c.Get(ctxKeyInputErrors); ok {
+		if errs := val.(FieldErrors); len(errs) > 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+// inputRaw 按参数查找顺序获取原始参数值，exist表示参数是否传递
+func (c *Context) inputRaw(key string) (val string, exist bool) {
+	if vals := c.inputValues(key); len(vals) > 0 {
+		return vals[0], true
+	}
+	return "", false
+}
+
+func (c *Context) inputExist(key string) bool {
+	_, exist := c.inputRaw(key)
+	return exist
+}
+
+func (c *Context) inputMust(key string, exist bool, err error) {
+	if !exist {
+		c.InputErrorAdd(FieldError{key, ErrorI18nNew("参数%s不能为空", key)})
+		return
+	}
+	c.InputErrorAdd(err)
+}
+
+func inputFormatError(key string) error {
+	return FieldError{key, ErrorI18nNew("参数%s格式错误", key)}
+}
+
 // InnerSucc 内部服务返回成功
 func (c *Context) InnerSucc(data interface{}) {
-	c.InnerReturn(100, data, "")
+	c.InnerReturn(InnerCodeSucc, data, "")
 }
 
 // InnerFail 内部服务返回失败信息
 func (c *Context) InnerFail(msg string) {
-	c.InnerReturn(101, nil, msg)
+	c.InnerReturn(InnerCodeFail, nil, msg)
 }
 
 // InnerReturn 内部服务返回
 // code 100:代表成功，其他的自定义错误，必须是3位数的code
 func (c *Context) InnerReturn(code int, data interface{}, msg string) {
-	if code == 100 {
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("内部服务返回码必须是3位数,code:%d", code))
+	}
+	if code == InnerCodeSucc {
 		//当100成功时，会将数据转换为json传递给msg
-		tmp, _ := json.Marshal(data)
-		msg = string(tmp)
+		tmp, err := json.Marshal(data)
+		if err != nil {
+			code, msg = InnerCodeFail, err.Error()
+		} else {
+			msg = string(tmp)
+		}
 	}
-	c.String(http.StatusOK, "%d%s", msg)
+	c.String(http.StatusOK, "%d%s", code, msg)
 }
 
 // GracefulExitWeb 具备优雅停止web服务的启动方式
+// 收到退出信号后通过DefaultLifecycle依次停止http服务、注销consul、停止消费者、关闭数据库并刷新日志
+// 需要https、h2c、unix socket或多个监听时使用ServeWeb
 func GracefulExitWeb(engine *gin.Engine, host, port string) {
-	log.Println("web服务启动, listen:" + host + ":" + port)
-	srv := &http.Server{
-		Addr:    net.JoinHostPort(host, port),
-		Handler: engine.Handler(),
-	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Println("server listen failed! error:", err.Error())
-		}
-	}()
-
-	// 平滑重启
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
-	sig := <-ch
-
-	log.Println("got a signal", sig)
-	now := time.Now()
-	cxt, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	err := srv.Shutdown(cxt)
+	err := ServeWeb(engine, WithListener(ListenerConfig{Addr: net.JoinHostPort(host, port)}))
 	if err != nil {
-		log.Println("err", err)
-	}
-
-	// 看看实际退出所耗费的时间
-	log.Println("------exited--------", time.Since(now))
-}
-
-// GinRecovery 接受gin框架http中panic的错误
-func GinRecovery(stack, notice bool) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		defer func() {
-			if e := recover(); e != nil {
-				var err error
-				switch v := e.(type) {
-				case error:
-					err = v
-				default:
-					err = fmt.Errorf("%v", v)
-				}
-
-				//记录日志
-				httpRequest, _ := httputil.DumpRequest(c.Request, false)
-				if stack {
-					Logger.Error("[Recovery from panic] path:"+c.Request.URL.Path,
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-						zap.StackSkip("track", 1),
-					)
-				} else {
-					Logger.Error("[Recovery from panic] path:"+c.Request.URL.Path,
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-					)
-				}
-
-				//返回系统错误
-				this := Context{c}
-				this.JsonError(ErrorI18nNew("系统异常"))
-				c.Abort()
-
-				// lark通知
-				if notice {
-					go LarkNotice("system", fmt.Sprintf("错误描述:%s", err.Error()), fmt.Sprintf("堆栈:\n%s", string(debug.Stack())), fmt.Sprintf("请求体:\n%s", string(httpRequest)))
-				}
-				return
-			}
-		}()
-		c.Next()
-	}
-}
-
-// GinLogger 接收gin框架的http请求日志，通常不使用
-func GinLogger() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		start := time.Now()
-		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
-		c.Next()
-
-		cost := time.Since(start)
-		Logger.Info(path,
-			zap.Int("status", c.Writer.Status()),
-			zap.String("method", c.Request.Method),
-			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
-			zap.String("user-agent", c.Request.UserAgent()),
-			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
-			zap.Duration("cost", cost),
-		)
-	}
-}
-
-var (
-	//MetricRequestDuration 请求耗时
-	MetricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "http_request_duration",
-		Buckets: []float64{10, 20, 30, 40, 50, 60, 70, 100, 200, 500},
-	}, []string{"path", "code"})
-)
-
-// MiddleRequestMetric 请求指标计算
-func MiddleRequestMetric(c *gin.Context) {
-	start := time.Now()
-	c.Next()
-	MetricRequestDuration.WithLabelValues(c.Request.URL.Path, strconv.Itoa(c.Writer.Status())).Observe(float64(time.Since(start).Milliseconds()))
+		log.Println("server listen failed! error:", err.Error())
+	}
 }
@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/Unknwon/goconfig v1.0.0 // indirect
+	github.com/andybalholm/brotli v1.0.4
 	github.com/apolloconfig/agollo/v4 v4.4.0
 	github.com/beego/i18n v0.0.0-20161101132742-e9308947f407
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
@@ -19,9 +20,10 @@ require (
 	github.com/xxl-job/xxl-job-executor-go v1.2.0
 	go.mongodb.org/mongo-driver v1.15.0
 	go.uber.org/zap v1.17.0
+	golang.org/x/net v0.20.0
 	golang.org/x/text v0.14.0
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
-	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gorm.io/driver/mysql v1.4.7
 	gorm.io/gorm v1.24.6
 )
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"github.com/beego/i18n"
 	"go.uber.org/zap"
-	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -48,11 +47,12 @@ func Lang(ctx context.Context) (lang string) {
 type ErrorI18n struct {
 	i18nCode string
 	args     []interface{}
+	code     int
 }
 
 // ErrorI18nNew 创建一个基于i18n的错误
 func ErrorI18nNew(i18nCode string, args ...interface{}) ErrorI18n {
-	return ErrorI18n{i18nCode, args}
+	return ErrorI18n{i18nCode: i18nCode, args: args}
 }
 
 func (e ErrorI18n) Error() string {
@@ -67,21 +67,84 @@ func (e ErrorI18n) ErrorWithLang(lang string) string {
 	return i18n.Tr(lang, e.i18nCode, e.args...)
 }
 
+// Code 业务错误码，未通过BizError创建时根据i18n编码查找已注册的错误码
+func (e ErrorI18n) Code() int {
+	if e.code != 0 {
+		return e.code
+	}
+	if b, ok := bizErrorByI18n(e.i18nCode); ok {
+		return b.Code
+	}
+	return 0
+}
+
+// Is 支持errors.Is(err, BizError)判断
+func (e ErrorI18n) Is(target error) bool {
+	if b, ok := target.(BizError); ok {
+		return e.Code() != 0 && e.Code() == b.Code
+	}
+	return false
+}
+
+// JsonError 通过当前请求的渲染器返回错误，ErrorI18n会按请求语言翻译，FieldErrors会按字段返回
+// 未指定code时使用已注册的业务错误码，并按业务错误的日志级别记录日志
 func (c *Context) JsonError(err error, code ...int) {
-	var resp GinJsonResp
-	resp.ErrorCode = 1
-	if len(code) > 0 {
-		resp.ErrorCode = code[0]
+	resp := c.errorResp(err, code...)
+	if b, ok := BizErrorGet(resp.ErrorCode); ok && Logger != nil {
+		if ce := c.Log().Check(b.Level, "业务错误"); ce != nil {
+			ce.Write(zap.Int("code", resp.ErrorCode), zap.String("path", c.Request.URL.Path), zap.Error(err))
+		}
 	}
+	c.JsonRender(resp)
+}
 
+func (c *Context) errorResp(err error, code ...int) RenderResp {
+	//超过请求截止时间的错误统一返回ErrTimeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		resp := c.errorResp(ErrTimeout, code...)
+		resp.Err = err
+		return resp
+	}
+	resp := RenderResp{Err: err}
+	resp.ErrorCode = ErrFail.Code
+
+	var fieldErrs FieldErrors
 	var i18nErr ErrorI18n
-	if errors.As(err, &i18nErr) {
+	var bizErr BizError
+	if errors.As(err, &fieldErrs) && len(fieldErrs) > 0 {
+		//参数校验错误按字段返回错误信息
+		resp.ErrorCode = ErrParam.Code
+		resp.Lang = Lang(c.Request.Context())
+		resp.MsgCode = fieldErrs[0].i18nCode
+		resp.ErrorMessage = fieldErrs[0].ErrorWithLang(resp.Lang)
+		fields := make(map[string]string, len(fieldErrs))
+		for _, val := range fieldErrs {
+			if _, ok := fields[val.Field]; !ok {
+				fields[val.Field] = val.ErrorWithLang(resp.Lang)
+			}
+		}
+		resp.Data = fields
+	} else if errors.As(err, &i18nErr) {
+		if errCode := i18nErr.Code(); errCode != 0 {
+			resp.ErrorCode = errCode
+		}
 		resp.Lang = Lang(c.Request.Context())
 		resp.MsgCode = i18nErr.i18nCode
 		resp.ErrorMessage = i18nErr.ErrorWithLang(resp.Lang)
+	} else if errors.As(err, &bizErr) {
+		resp.ErrorCode = bizErr.Code
+		resp.Lang = Lang(c.Request.Context())
+		resp.MsgCode = bizErr.I18nCode
+		resp.ErrorMessage = i18n.Tr(resp.Lang, bizErr.I18nCode)
 	} else {
 		resp.ErrorMessage = err.Error()
 	}
+	if len(code) > 0 {
+		resp.ErrorCode = code[0]
+	}
+	if b, ok := BizErrorGet(resp.ErrorCode); ok {
+		resp.HttpStatus = b.HttpStatus
+	}
 
-	c.JSON(http.StatusOK, resp)
+	return resp
 }
@@ -0,0 +1,430 @@
+package ginlib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IdempotencyHeader         = "Idempotency-Key"      //幂等键请求头
+	IdempotencyReplayedHeader = "Idempotency-Replayed" //重放保存的响应时设置为true
+)
+
+var (
+	ErrIdempotencyKey        = BizErrorRegister(4003, "Idempotency-Key无效", http.StatusBadRequest, zapcore.InfoLevel)
+	ErrIdempotencyInProgress = BizErrorRegister(4090, "请求处理中,请勿重复提交", http.StatusConflict, zapcore.InfoLevel)
+	ErrIdempotencyMismatch   = BizErrorRegister(4220, "Idempotency-Key已用于其他请求", http.StatusUnprocessableEntity, zapcore.InfoLevel)
+	ErrIdempotencyStore      = BizErrorRegister(5031, "请求暂时无法处理,请稍后再试", http.StatusServiceUnavailable, zapcore.ErrorLevel)
+)
+
+// IdempotentResponse 保存的首次响应
+type IdempotentResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+	RequestHash string `json:"request_hash"` //首次请求的路径与请求体的sha256，重试的请求不一致时拒绝
+}
+
+// IdempotencyStore 幂等键存储
+type IdempotencyStore interface {
+	// Acquire 已保存响应时返回该响应，否则尝试以随机token加锁，锁被占用时token为空
+	Acquire(key string, lockTTL time.Duration) (resp *IdempotentResponse, token string, err error)
+	// Save 仍持有token对应的锁时保存响应并释放锁，锁已过期被其他请求获取时不保存
+	Save(key, token string, resp *IdempotentResponse, ttl time.Duration) error
+	// Release 仍持有token对应的锁时释放锁，不保存响应，之后的重试会重新执行
+	Release(key, token string) error
+}
+
+var (
+	errIdempotencyLockLost = errors.New("幂等锁已过期")
+)
+
+type idempotency struct {
+	store    IdempotencyStore
+	ttl      time.Duration
+	lockTTL  time.Duration
+	methods  map[string]bool
+	required bool
+	failOpen bool
+	maxBody  int64
+}
+
+type IdempotencyOption func(i *idempotency)
+
+// WithIdempotencyTTL 响应的保存时间，默认24小时
+func WithIdempotencyTTL(d time.Duration) IdempotencyOption {
+	return func(i *idempotency) {
+		i.ttl = d
+	}
+}
+
+// WithIdempotencyLockTTL 处理中的锁的过期时间，需大于handler的最长执行时间，默认1分钟
+func WithIdempotencyLockTTL(d time.Duration) IdempotencyOption {
+	return func(i *idempotency) {
+		i.lockTTL = d
+	}
+}
+
+// WithIdempotencyMethods 需要处理幂等键的请求方法，默认POST
+func WithIdempotencyMethods(methods ...string) IdempotencyOption {
+	return func(i *idempotency) {
+		i.methods = make(map[string]bool, len(methods))
+		for _, val := range methods {
+			i.methods[strings.ToUpper(val)] = true
+		}
+	}
+}
+
+// WithIdempotencyRequired 为true时缺少Idempotency-Key返回ErrIdempotencyKey，默认不带时直接执行
+func WithIdempotencyRequired(required bool) IdempotencyOption {
+	return func(i *idempotency) {
+		i.required = required
+	}
+}
+
+// WithIdempotencyFailOpen 为true时存储出错直接执行请求，此时无法防止重复提交，默认返回ErrIdempotencyStore
+func WithIdempotencyFailOpen(failOpen bool) IdempotencyOption {
+	return func(i *idempotency) {
+		i.failOpen = failOpen
+	}
+}
+
+// WithIdempotencyMaxBody 计算请求摘要时读取的请求体上限(字节)，超出时返回ErrBodyTooLarge，默认10M，BodyLimitWare的限制优先
+func WithIdempotencyMaxBody(n int64) IdempotencyOption {
+	return func(i *idempotency) {
+		i.maxBody = n
+	}
+}
+
+// IdempotencyWare 幂等中间件，store为nil时使用进程内存储
+// 按请求方法、路由、uid与Idempotency-Key加锁，保存首次完成的响应状态码与响应体，重试时直接返回保存的响应
+// 首次请求处理中时重复请求返回ErrIdempotencyInProgress，5xx、panic以及流式响应不保存，释放锁后可重试
+// 重试的请求路径或请求体与首次请求不一致时返回ErrIdempotencyMismatch
+// 需放在AuthWare之后以区分用户，存储出错时返回ErrIdempotencyStore，可通过WithIdempotencyFailOpen放行
+func IdempotencyWare(store IdempotencyStore, opts ...IdempotencyOption) gin.HandlerFunc {
+	if store == nil {
+		store = NewMemoryIdempotencyStore()
+	}
+	i := &idempotency{
+		store:   store,
+		ttl:     24 * time.Hour,
+		lockTTL: time.Minute,
+		methods: map[string]bool{http.MethodPost: true},
+		maxBody: 10 << 20,
+	}
+	for _, o := range opts {
+		o(i)
+	}
+	return func(c *gin.Context) {
+		if !i.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+		this := Context{c}
+		idemKey := c.GetHeader(IdempotencyHeader)
+		if idemKey == "" && !i.required {
+			c.Next()
+			return
+		}
+		if idemKey == "" || len(idemKey) > 255 {
+			this.JsonError(ErrIdempotencyKey.New())
+			c.Abort()
+			return
+		}
+		key := c.Request.Method + ":" + c.FullPath() + ":" + strconv.FormatInt(c.GetInt64("uid"), 10) + ":" + idemKey
+		limit := bodyLimit(c, i.maxBody)
+		if c.Request.ContentLength > limit {
+			this.JsonError(ErrBodyTooLarge.New(uploadSizeStr(limit)))
+			c.Abort()
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		body, err := this.bodyBytes()
+		if err != nil {
+			if strings.Contains(err.Error(), "request body too large") {
+				this.JsonError(ErrBodyTooLarge.New(uploadSizeStr(limit)))
+			} else {
+				this.JsonError(ErrBodyFormat.New())
+			}
+			c.Abort()
+			return
+		}
+		reqHash := idempotencyRequestHash(c.Request.URL.RequestURI(), body)
+
+		resp, token, err := i.store.Acquire(key, i.lockTTL)
+		if err != nil {
+			this.Log().Warn("幂等键存储出错", zap.String("key", key), zap.Error(err))
+			if i.failOpen {
+				c.Next()
+				return
+			}
+			this.JsonError(ErrIdempotencyStore.New())
+			c.Abort()
+			return
+		}
+		if resp != nil {
+			if resp.RequestHash != reqHash {
+				this.JsonError(ErrIdempotencyMismatch.New())
+				c.Abort()
+				return
+			}
+			c.Header(IdempotencyReplayedHeader, "true")
+			if resp.ContentType != "" {
+				c.Header("Content-Type", resp.ContentType)
+			}
+			c.Status(resp.Status)
+			c.Writer.Write(resp.Body)
+			c.Abort()
+			return
+		}
+		if token == "" {
+			this.JsonError(ErrIdempotencyInProgress.New())
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		saved := false
+		defer func() {
+			if !saved {
+				if err := i.store.Release(key, token); err != nil {
+					this.Log().Warn("幂等键释放失败", zap.String("key", key), zap.Error(err))
+				}
+			}
+		}()
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !i.cacheable(&this) {
+			return
+		}
+		err = i.store.Save(key, token, &IdempotentResponse{
+			Status:      c.Writer.Status(),
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+			RequestHash: reqHash,
+		}, i.ttl)
+		if err != nil {
+			this.Log().Warn("幂等响应保存失败", zap.String("key", key), zap.Error(err))
+			return
+		}
+		saved = true
+	}
+}
+
+// idempotencyRequestHash 请求路径(含参数)与请求体的摘要
+func idempotencyRequestHash(uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(uri))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheable 5xx、业务错误码对应5xx以及流式响应不保存
+func (i *idempotency) cacheable(c *Context) bool {
+	if c.Writer.Status() >= http.StatusInternalServerError || streamStatOf(c.Context) != nil {
+		return false
+	}
+	if code, ok := c.ErrorCode(); ok {
+		if b, ok := BizErrorGet(code); ok && b.HttpStatus >= http.StatusInternalServerError {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotencyWriter 记录完整的响应体
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// memoryIdempotencyStore 进程内的幂等键存储，只适用于单实例部署
+type memoryIdempotencyStore struct {
+	lock      sync.Mutex
+	items     map[string]*memoryIdempotencyItem
+	lastClean time.Time
+}
+
+type memoryIdempotencyItem struct {
+	resp   *IdempotentResponse
+	token  string
+	expire time.Time
+}
+
+// NewMemoryIdempotencyStore 创建进程内的幂等键存储
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{items: make(map[string]*memoryIdempotencyItem), lastClean: time.Now()}
+}
+
+func (m *memoryIdempotencyStore) Acquire(key string, lockTTL time.Duration) (*IdempotentResponse, string, error) {
+	token, err := idempotencyToken()
+	if err != nil {
+		return nil, "", err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	//定期清理过期的记录
+	if now.Sub(m.lastClean) > time.Minute {
+		for k, val := range m.items {
+			if now.After(val.expire) {
+				delete(m.items, k)
+			}
+		}
+		m.lastClean = now
+	}
+	if item, ok := m.items[key]; ok && now.Before(item.expire) {
+		return item.resp, "", nil
+	}
+	m.items[key] = &memoryIdempotencyItem{token: token, expire: now.Add(lockTTL)}
+	return nil, token, nil
+}
+
+// owned 锁未过期且token一致
+func (m *memoryIdempotencyStore) owned(key, token string) bool {
+	item, ok := m.items[key]
+	return ok && item.resp == nil && item.token == token && time.Now().Before(item.expire)
+}
+
+func (m *memoryIdempotencyStore) Save(key, token string, resp *IdempotentResponse, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.owned(key, token) {
+		return errIdempotencyLockLost
+	}
+	m.items[key] = &memoryIdempotencyItem{resp: resp, expire: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Release(key, token string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.owned(key, token) {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+// redisIdempotencyStore 基于redis的幂等键存储，适用于多实例部署
+type redisIdempotencyStore struct {
+	redisCli *redis.Client
+	prefix   string
+}
+
+// NewRedisIdempotencyStore 创建基于redis的幂等键存储
+func NewRedisIdempotencyStore(redisCli *redis.Client) IdempotencyStore {
+	return &redisIdempotencyStore{redisCli: redisCli, prefix: "idempotency:"}
+}
+
+// KEYS: 响应key, 锁key ARGV: 锁token, 锁过期毫秒，返回保存的响应、1加锁成功或0锁被占用
+var idempotencyAcquireScript = redis.NewScript(`
+local resp = redis.call("GET", KEYS[1])
+if resp then
+	return resp
+end
+if redis.call("SET", KEYS[2], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// KEYS: 响应key, 锁key ARGV: 锁token, 响应, 响应过期毫秒，锁仍属于token时保存响应并删除锁，返回1，否则返回0
+var idempotencySaveScript = redis.NewScript(`
+if redis.call("GET", KEYS[2]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+redis.call("DEL", KEYS[2])
+return 1
+`)
+
+// KEYS: 锁key ARGV: 锁token，锁仍属于token时删除
+var idempotencyReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (r *redisIdempotencyStore) Acquire(key string, lockTTL time.Duration) (*IdempotentResponse, string, error) {
+	token, err := idempotencyToken()
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := idempotencyAcquireScript.Run(r.redisCli, []string{r.prefix + key, r.prefix + key + ":lock"}, token, lockTTL.Milliseconds()).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	switch val := res.(type) {
+	case int64:
+		if val != 1 {
+			token = ""
+		}
+		return nil, token, nil
+	case string:
+		resp := &IdempotentResponse{}
+		if err = json.Unmarshal([]byte(val), resp); err != nil {
+			return nil, "", fmt.Errorf("幂等响应解析失败:%w", err)
+		}
+		return resp, "", nil
+	}
+	return nil, "", fmt.Errorf("幂等脚本返回格式错误:%v", res)
+}
+
+func (r *redisIdempotencyStore) Save(key, token string, resp *IdempotentResponse, ttl time.Duration) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	res, err := idempotencySaveScript.Run(r.redisCli, []string{r.prefix + key, r.prefix + key + ":lock"}, token, data, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return errIdempotencyLockLost
+	}
+	return nil
+}
+
+func (r *redisIdempotencyStore) Release(key, token string) error {
+	return idempotencyReleaseScript.Run(r.redisCli, []string{r.prefix + key + ":lock"}, token).Err()
+}
+
+// idempotencyToken 生成锁的随机token，区分锁过期后被其他请求获取的情况
+func idempotencyToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,188 @@
+package ginlib
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ctxKeyInnerCaller = "ginlib.inner_caller"
+)
+
+// NonceStore 防重放随机串存储
+type NonceStore interface {
+	// Use 记录nonce，nonce在ttl内已被使用时返回false
+	Use(nonce string, ttl time.Duration) (bool, error)
+}
+
+// memoryNonceStore 进程内的随机串存储，只适用于单实例部署
+type memoryNonceStore struct {
+	lock      sync.Mutex
+	items     map[string]time.Time
+	lastClean time.Time
+}
+
+// NewMemoryNonceStore 创建进程内的随机串存储
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{items: make(map[string]time.Time), lastClean: time.Now()}
+}
+
+func (m *memoryNonceStore) Use(nonce string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	//定期清理过期的随机串
+	if now.Sub(m.lastClean) > ttl {
+		for key, expire := range m.items {
+			if now.After(expire) {
+				delete(m.items, key)
+			}
+		}
+		m.lastClean = now
+	}
+	if expire, ok := m.items[nonce]; ok && now.Before(expire) {
+		return false, nil
+	}
+	m.items[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// redisNonceStore 基于redis的随机串存储，适用于多实例部署
+type redisNonceStore struct {
+	redisCli *redis.Client
+	prefix   string
+}
+
+// NewRedisNonceStore 创建基于redis的随机串存储
+func NewRedisNonceStore(redisCli *redis.Client) NonceStore {
+	return &redisNonceStore{redisCli: redisCli, prefix: "inner_nonce:"}
+}
+
+func (r *redisNonceStore) Use(nonce string, ttl time.Duration) (bool, error) {
+	return r.redisCli.SetNX(r.prefix+nonce, 1, ttl).Result()
+}
+
+// InnerSecretFunc 根据调用方名称获取密钥，调用方不存在时返回false
+type InnerSecretFunc func(caller string) (secret string, ok bool)
+
+type innerAuth struct {
+	secrets    InnerSecretFunc
+	maxSkew    time.Duration
+	nonceStore NonceStore
+}
+
+type InnerAuthOption func(a *innerAuth)
+
+// WithInnerAuthSecrets 自定义调用方密钥获取方式
+func WithInnerAuthSecrets(secrets InnerSecretFunc) InnerAuthOption {
+	return func(a *innerAuth) {
+		a.secrets = secrets
+	}
+}
+
+// WithInnerAuthMaxSkew 设置允许的时间戳偏差，默认5分钟
+func WithInnerAuthMaxSkew(d time.Duration) InnerAuthOption {
+	return func(a *innerAuth) {
+		a.maxSkew = d
+	}
+}
+
+// WithInnerAuthNonceStore 设置防重放随机串存储，默认使用进程内存储
+func WithInnerAuthNonceStore(store NonceStore) InnerAuthOption {
+	return func(a *innerAuth) {
+		a.nonceStore = store
+	}
+}
+
+// InnerSecretFromConfig 从阿波罗配置中获取调用方密钥
+// 优先读取每个调用方独立的密钥server.<ProjectName>.callers.<caller>.secret；
+// 未配置时兼容原有配置，caller在server.<ProjectName>.caller(","分隔多个调用方)中时使用server.<ProjectName>.secret，
+// 即InnerClient默认签名使用的密钥。迁移时先为调用方配置独立密钥，调用方切换到该密钥后再从原有caller中移除
+func InnerSecretFromConfig(caller string) (secret string, ok bool) {
+	if caller == "" || strings.ContainsAny(caller, ". ") {
+		return "", false
+	}
+	if secret = ConfigVal(fmt.Sprintf("server.%s.callers.%s.secret", ProjectName, caller)); secret != "" {
+		return secret, true
+	}
+	_, callers, secret := ServerConfigGet(ProjectName)
+	for _, val := range strings.Split(callers, ",") {
+		if strings.TrimSpace(val) == caller && secret != "" {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+// InnerAuthWare 内部服务调用方认证，校验InnerClient生成的签名
+// 拒绝时间戳过期、随机串重复以及签名错误的请求，认证通过后可使用Context.InnerCaller获取调用方
+func InnerAuthWare(opts ...InnerAuthOption) gin.HandlerFunc {
+	a := &innerAuth{
+		secrets:    InnerSecretFromConfig,
+		maxSkew:    5 * time.Minute,
+		nonceStore: NewMemoryNonceStore(),
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return func(c *gin.Context) {
+		this := Context{c}
+		caller, reason := a.verify(&this)
+		if reason != "" {
+			Logger.Warn("内部服务认证失败", zap.String("path", c.Request.URL.Path), zap.String("caller", caller), zap.String("ip", c.ClientIP()), zap.String("reason", reason))
+			this.InnerReturn(401, nil, "内部服务认证失败:"+reason)
+			c.Abort()
+			return
+		}
+		c.Set(ctxKeyInnerCaller, caller)
+		c.Next()
+	}
+}
+
+// verify 校验签名，失败时返回失败原因
+func (a *innerAuth) verify(c *Context) (caller string, reason string) {
+	caller = c.GetHeader(InnerHeaderCaller)
+	timestamp := c.GetHeader(InnerHeaderTimestamp)
+	nonce := c.GetHeader(InnerHeaderNonce)
+	sign := c.GetHeader(InnerHeaderSign)
+	if caller == "" || timestamp == "" || nonce == "" || sign == "" {
+		return caller, "缺少认证信息"
+	}
+	secret, ok := a.secrets(caller)
+	if !ok {
+		return caller, "未知的调用方"
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return caller, "时间戳格式错误"
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return caller, "时间戳已过期"
+	}
+	body, err := c.bodyBytes()
+	if err != nil {
+		return caller, "读取请求体失败"
+	}
+	if !hmac.Equal([]byte(sign), []byte(InnerSign(secret, caller, timestamp, nonce, body))) {
+		return caller, "签名错误"
+	}
+	//签名通过后再记录随机串，避免伪造请求占用随机串
+	if ok, err = a.nonceStore.Use(caller+":"+nonce, 2*a.maxSkew); err != nil {
+		return caller, "随机串校验失败"
+	} else if !ok {
+		return caller, "重复的请求"
+	}
+	return caller, ""
+}
+
+// InnerCaller 获取通过InnerAuthWare认证的调用方名称
+func (c *Context) InnerCaller() string {
+	return c.GetString(ctxKeyInnerCaller)
+}
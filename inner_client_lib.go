@@ -0,0 +1,229 @@
+package ginlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	InnerCodeSucc = 100 //内部服务成功返回码
+	InnerCodeFail = 101 //内部服务默认失败返回码
+
+	InnerHeaderCaller    = "X-Inner-Caller"    //调用方名称
+	InnerHeaderTimestamp = "X-Inner-Timestamp" //调用时间戳(秒)
+	InnerHeaderNonce     = "X-Inner-Nonce"     //随机串，防重放
+	InnerHeaderSign      = "X-Inner-Sign"      //签名
+)
+
+var (
+	//metricInnerDuration 内部服务调用耗时，<namespace>_inner_client_duration
+	metricInnerDuration = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "inner_client_duration",
+			Buckets:   []float64{10, 20, 30, 50, 100, 200, 500, 1000, 3000},
+		}, []string{"service", "path", "code"})
+	})
+)
+
+// InnerError 内部服务返回的非100错误
+type InnerError struct {
+	Service string
+	Path    string
+	Code    int
+	Msg     string
+}
+
+func (e *InnerError) Error() string {
+	return fmt.Sprintf("内部服务%s%s返回错误,code:%d,msg:%s", e.Service, e.Path, e.Code, e.Msg)
+}
+
+// InnerSign 计算内部服务调用签名
+// 签名内容为 caller\ntimestamp\nnonce\nsha256(body)，使用secret做HMAC-SHA256后hex编码
+func InnerSign(secret, caller, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(caller + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// InnerResolver 根据服务名获取内部服务的地址、调用方名称以及密钥
+type InnerResolver func(name string) (host, caller, secret string)
+
+// InnerClient 内部服务客户端，与InnerReturn的返回协议对应
+type InnerClient struct {
+	name      string
+	resolver  InnerResolver
+	client    *http.Client
+	retries   int
+	retryWait time.Duration
+	breaker   *CircuitBreaker
+}
+
+type InnerOption func(c *InnerClient)
+
+// WithInnerTimeout 设置单次请求的超时时间，默认5秒
+func WithInnerTimeout(d time.Duration) InnerOption {
+	return func(c *InnerClient) {
+		c.client.Timeout = d
+	}
+}
+
+// WithInnerRetry 设置网络错误或http 5xx时的重试次数与重试间隔，默认不重试
+func WithInnerRetry(retries int, wait time.Duration) InnerOption {
+	return func(c *InnerClient) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// WithInnerResolver 自定义服务地址解析，默认使用ServerConfigGet
+func WithInnerResolver(resolver InnerResolver) InnerOption {
+	return func(c *InnerClient) {
+		c.resolver = resolver
+	}
+}
+
+// WithInnerTransport 自定义http传输层
+func WithInnerTransport(transport http.RoundTripper) InnerOption {
+	return func(c *InnerClient) {
+		c.client.Transport = transport
+	}
+}
+
+// WithInnerCircuitBreaker 通过熔断器调用，网络错误、超时与http 5xx计为失败，熔断时返回ErrCircuitOpen
+func WithInnerCircuitBreaker(breaker *CircuitBreaker) InnerOption {
+	return func(c *InnerClient) {
+		c.breaker = breaker
+	}
+}
+
+// NewInnerClient 根据服务名创建内部服务客户端，默认通过ServerConfigGet获取host/caller/secret
+func NewInnerClient(name string, opts ...InnerOption) *InnerClient {
+	c := &InnerClient{
+		name:     name,
+		resolver: ServerConfigGet,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Call 调用内部服务，params序列化为json请求体，返回100时将数据解析到result
+// 返回非100时返回*InnerError
+func (c *InnerClient) Call(ctx context.Context, path string, params interface{}, result interface{}) error {
+	start := time.Now()
+	var code int
+	var payload []byte
+	var err error
+	if c.breaker != nil {
+		err = c.breaker.Do(func() error {
+			code, payload, err = c.call(ctx, path, params)
+			return err
+		})
+	} else {
+		code, payload, err = c.call(ctx, path, params)
+	}
+	metricCode := strconv.Itoa(code)
+	if err != nil {
+		metricCode = "error"
+	}
+	metricInnerDuration.histogram().WithLabelValues(c.name, path, metricCode).Observe(float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		LoggerFrom(ctx).Error("内部服务调用失败", zap.String("service", c.name), zap.String("path", path), zap.Error(err))
+		return err
+	}
+	if code != InnerCodeSucc {
+		return &InnerError{Service: c.name, Path: path, Code: code, Msg: string(payload)}
+	}
+	if result == nil || len(payload) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(payload, result); err != nil {
+		return fmt.Errorf("内部服务%s%s返回数据解析失败:%w", c.name, path, err)
+	}
+	return nil
+}
+
+// call 发送请求并解析返回码，网络错误或http 5xx时按配置重试
+func (c *InnerClient) call(ctx context.Context, path string, params interface{}) (code int, payload []byte, err error) {
+	host, caller, secret := c.resolver(c.name)
+	if host == "" {
+		return 0, nil, fmt.Errorf("未找到内部服务%s的地址", c.name)
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	body := []byte{}
+	if params != nil {
+		if body, err = json.Marshal(params); err != nil {
+			return 0, nil, err
+		}
+	}
+	for i := 0; ; i++ {
+		var retry bool
+		code, payload, retry, err = c.do(ctx, strings.TrimRight(host, "/")+path, caller, secret, body)
+		if err == nil || !retry || i >= c.retries {
+			return
+		}
+		LoggerFrom(ctx).Warn("内部服务调用重试", zap.String("service", c.name), zap.String("path", path), zap.Int("retry", i+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-time.After(c.retryWait):
+		}
+	}
+}
+
+func (c *InnerClient) do(ctx context.Context, url, caller, secret string, body []byte) (code int, payload []byte, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := UniqueId()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(InnerHeaderCaller, caller)
+	req.Header.Set(InnerHeaderTimestamp, timestamp)
+	req.Header.Set(InnerHeaderNonce, nonce)
+	req.Header.Set(InnerHeaderSign, InnerSign(secret, caller, timestamp, nonce, body))
+	if id := RequestIDFrom(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, resp.StatusCode >= 500, fmt.Errorf("http状态码错误:%d,body:%s", resp.StatusCode, Substr(string(raw), 0, 200))
+	}
+	if len(raw) < 3 {
+		return 0, nil, false, fmt.Errorf("返回内容不符合内部服务协议:%s", string(raw))
+	}
+	code, err = strconv.Atoi(string(raw[:3]))
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("返回内容不符合内部服务协议:%s", Substr(string(raw), 0, 200))
+	}
+	return code, raw[3:], false, nil
+}
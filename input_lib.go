@@ -0,0 +1,271 @@
+package ginlib
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ctxKeyInputSources = "ginlib.input_sources"
+)
+
+// InputSource 参数来源
+type InputSource string
+
+const (
+	InputSourceQuery  InputSource = "query"  //url查询参数
+	InputSourceForm   InputSource = "form"   //表单参数
+	InputSourceJson   InputSource = "json"   //json请求体
+	InputSourceParam  InputSource = "param"  //路由参数，如/user/:id
+	InputSourceHeader InputSource = "header" //请求头，只读取InputHeaders中配置的参数
+)
+
+var (
+	// InputSources Input*与Bind默认的参数查找顺序，先找到的参数优先
+	InputSources = []InputSource{InputSourceQuery, InputSourceForm, InputSourceJson, InputSourceParam, InputSourceHeader}
+
+	// InputHeaders 允许从请求头读取的参数，key:参数名 value:请求头名称
+	InputHeaders = map[string]string{}
+)
+
+// InputSourcesWare 为路由或路由组设置参数查找顺序
+func InputSourcesWare(sources ...InputSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxKeyInputSources, sources)
+		c.Next()
+	}
+}
+
+// inputSources 获取当前请求的参数查找顺序
+func (c *Context) inputSources() []InputSource {
+	if val, ok := c.Get(ctxKeyInputSources); ok {
+		if sources, ok := val.([]InputSource); ok {
+			return sources
+		}
+	}
+	return InputSources
+}
+
+// inputValues 按参数查找顺序获取参数的所有值，未传递时返回nil
+func (c *Context) inputValues(key string) []string {
+	for _, source := range c.inputSources() {
+		vals := c.inputSourceValues(source, key)
+		if len(vals) == 0 || (len(vals) == 1 && vals[0] == "") {
+			continue
+		}
+		return vals
+	}
+	return nil
+}
+
+// inputSourceValues 从指定来源获取参数值
+func (c *Context) inputSourceValues(source InputSource, key string) []string {
+	switch source {
+	case InputSourceQuery:
+		return c.QueryArray(key)
+	case InputSourceForm:
+		if c.Request.Method == "GET" {
+			return nil
+		}
+		return c.PostFormArray(key)
+	case InputSourceJson:
+		body, _ := c.jsonBody()
+		if val, ok := body[key]; ok {
+			return jsonValueStrs(val)
+		}
+	case InputSourceParam:
+		if val := c.Param(key); val != "" {
+			return []string{val}
+		}
+	case InputSourceHeader:
+		if name, ok := InputHeaders[key]; ok {
+			return c.Request.Header[textproto.CanonicalMIMEHeaderKey(name)]
+		}
+	}
+	return nil
+}
+
+// inputSourceAll 获取指定来源的全部参数
+func (c *Context) inputSourceAll(source InputSource) (map[string][]string, error) {
+	switch source {
+	case InputSourceQuery:
+		return c.Request.URL.Query(), nil
+	case InputSourceForm:
+		if c.Request.Method == "GET" {
+			return nil, nil
+		}
+		c.PostForm("") //触发gin解析表单
+		return c.Request.PostForm, nil
+	case InputSourceJson:
+		body, err := c.jsonBody()
+		if err != nil {
+			return nil, ErrBodyFormat.New()
+		}
+		values := make(map[string][]string, len(body))
+		for key, val := range body {
+			values[key] = jsonValueStrs(val)
+		}
+		return values, nil
+	case InputSourceParam:
+		values := make(map[string][]string, len(c.Params))
+		for _, val := range c.Params {
+			values[val.Key] = []string{val.Value}
+		}
+		return values, nil
+	case InputSourceHeader:
+		values := make(map[string][]string, len(InputHeaders))
+		for key, name := range InputHeaders {
+			if val := c.Request.Header[textproto.CanonicalMIMEHeaderKey(name)]; len(val) > 0 {
+				values[key] = val
+			}
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+const (
+	InputTimeUnix      = "unix"      //InputTime按unix秒解析
+	InputTimeUnixMilli = "unixmilli" //InputTime按unix毫秒解析
+)
+
+var (
+	// InputSliceSep 切片参数的分隔符，如ids=1,2,3
+	InputSliceSep = ","
+)
+
+// InputStrSlice 获取字符串切片参数，支持tag=a&tag=b与tags=a,b两种形式
+func (c *Context) InputStrSlice(key string, defs ...[]string) []string {
+	vals := c.inputSlice(key)
+	if len(vals) == 0 {
+		if len(defs) > 0 {
+			return defs[0]
+		}
+		return []string{}
+	}
+	return vals
+}
+
+// InputIntSlice 获取int切片参数，支持ids=1&ids=2与ids=1,2两种形式，存在格式错误时返回空切片
+func (c *Context) InputIntSlice(key string, defs ...[]int) []int {
+	res, err := c.InputIntSliceE(key, defs...)
+	if err != nil {
+		return []int{}
+	}
+	return res
+}
+
+// InputIntSliceE 获取int切片参数，存在格式错误的值时返回error
+func (c *Context) InputIntSliceE(key string, defs ...[]int) ([]int, error) {
+	vals := c.inputSlice(key)
+	if len(vals) == 0 {
+		if len(defs) > 0 {
+			return defs[0], nil
+		}
+		return []int{}, nil
+	}
+	res := make([]int, 0, len(vals))
+	for _, val := range vals {
+		t, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, inputFormatError(key)
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// InputMap 获取map参数，支持filter[status]=1形式的query、form参数以及json对象
+func (c *Context) InputMap(key string, defs ...map[string]string) map[string]string {
+	for _, source := range c.inputSources() {
+		var res map[string]string
+		switch source {
+		case InputSourceQuery:
+			res = c.QueryMap(key)
+		case InputSourceForm:
+			if c.Request.Method != "GET" {
+				res = c.PostFormMap(key)
+			}
+		case InputSourceJson:
+			body, _ := c.jsonBody()
+			if obj, ok := body[key].(map[string]interface{}); ok {
+				res = make(map[string]string, len(obj))
+				for k, v := range obj {
+					if vals := jsonValueStrs(v); len(vals) > 0 {
+						res[k] = vals[0]
+					}
+				}
+			}
+		}
+		if len(res) > 0 {
+			return res
+		}
+	}
+	if len(defs) > 0 {
+		return defs[0]
+	}
+	return map[string]string{}
+}
+
+// InputTime 获取时间参数，格式错误时返回零值
+// layout 时间格式，使用InputTimeUnix、InputTimeUnixMilli解析时间戳
+// loc 解析时使用的时区，如LocalUtc7()，nil表示使用本地时区
+func (c *Context) InputTime(key, layout string, loc *time.Location, defs ...time.Time) time.Time {
+	t, _ := c.InputTimeE(key, layout, loc, defs...)
+	return t
+}
+
+// InputTimeE 获取时间参数，参数格式错误时返回error，未传递时返回默认值
+func (c *Context) InputTimeE(key, layout string, loc *time.Location, defs ...time.Time) (time.Time, error) {
+	var def time.Time
+	if len(defs) > 0 {
+		def = defs[0]
+	}
+	val, exist := c.inputRaw(key)
+	if !exist {
+		return def, nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	var t time.Time
+	var err error
+	switch layout {
+	case InputTimeUnix, InputTimeUnixMilli:
+		var n int64
+		if n, err = strconv.ParseInt(val, 10, 64); err == nil {
+			if layout == InputTimeUnix {
+				t = time.Unix(n, 0).In(loc)
+			} else {
+				t = time.Unix(n/1000, (n%1000)*int64(time.Millisecond)).In(loc)
+			}
+		}
+	default:
+		t, err = time.ParseInLocation(layout, val, loc)
+	}
+	if err != nil {
+		return time.Time{}, inputFormatError(key)
+	}
+	return t, nil
+}
+
+// inputSlice 获取切片参数的所有值，单个值时按InputSliceSep切分
+func (c *Context) inputSlice(key string) []string {
+	vals := c.inputValues(key)
+	if len(vals) == 0 {
+		vals = c.inputValues(key + "[]")
+	}
+	if len(vals) == 1 {
+		vals = strings.Split(vals[0], InputSliceSep)
+	}
+	res := make([]string, 0, len(vals))
+	for _, val := range vals {
+		if val = strings.TrimSpace(val); val != "" {
+			res = append(res, val)
+		}
+	}
+	return res
+}
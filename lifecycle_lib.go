@@ -0,0 +1,214 @@
+package ginlib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// 停止钩子的优先级，数值越小越先执行
+const (
+	StopPriorityServer   = 10 //停止http服务，等待处理中的请求完成
+	StopPriorityRegistry = 20 //从consul等注册中心注销
+	StopPriorityConsumer = 30 //停止消息消费者、定时任务执行器
+	StopPriorityDB       = 40 //关闭mysql、mongo等连接池
+	StopPriorityLogger   = 50 //刷新日志缓冲
+)
+
+var (
+	// DefaultLifecycle 默认的生命周期管理器，ginlib创建的组件会自动注册到该管理器
+	DefaultLifecycle = NewLifecycle()
+)
+
+type lifecycleHook struct {
+	name     string
+	priority int
+	timeout  time.Duration
+	fn       func(ctx context.Context) error
+}
+
+// Lifecycle 应用生命周期管理，按优先级执行启动与停止钩子
+type Lifecycle struct {
+	StopTimeout time.Duration //未指定超时时间的停止钩子的默认超时时间，默认5秒
+	DrainDelay  time.Duration //就绪状态置为false后，等待负载均衡摘除流量的时间，默认0即立即停止服务，部署在负载均衡后时应设置为不小于健康检查间隔乘以失败阈值
+
+	lock       sync.Mutex
+	starts     []lifecycleHook
+	stops      []lifecycleHook
+	ready      int32
+	restarting int32
+	stopOnce   sync.Once
+	done       chan struct{}
+}
+
+// NewLifecycle 创建生命周期管理器，创建后即为就绪状态
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		StopTimeout: 5 * time.Second,
+		ready:       1,
+		done:        make(chan struct{}),
+	}
+}
+
+// OnStart 注册启动钩子，Start时按priority从小到大执行，name相同时替换已注册的钩子，ServeWeb在开始服务前调用Start
+func (l *Lifecycle) OnStart(name string, priority int, fn func(ctx context.Context) error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.starts = lifecycleHookSet(l.starts, lifecycleHook{name: name, priority: priority, fn: fn})
+}
+
+// OnStop 注册停止钩子，Stop时按priority从小到大执行，name相同时替换已注册的钩子，避免重复初始化时钩子堆积
+// 每个需要关闭的资源应使用不同的name，如连接池名称中带上连接池地址
+// timeout 钩子的超时时间，不传时使用StopTimeout
+func (l *Lifecycle) OnStop(name string, priority int, fn func(ctx context.Context) error, timeout ...time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	hook := lifecycleHook{name: name, priority: priority, fn: fn}
+	if len(timeout) > 0 {
+		hook.timeout = timeout[0]
+	}
+	l.stops = lifecycleHookSet(l.stops, hook)
+}
+
+func lifecycleHookSet(hooks []lifecycleHook, hook lifecycleHook) []lifecycleHook {
+	for i, val := range hooks {
+		if val.name == hook.name {
+			hooks[i] = hook
+			return hooks
+		}
+	}
+	return append(hooks, hook)
+}
+
+// Start 执行所有启动钩子，任一钩子失败时返回错误
+func (l *Lifecycle) Start(ctx context.Context) error {
+	for _, hook := range l.sortedHooks(false) {
+		lifecycleLog("执行启动钩子:" + hook.name)
+		if err := hook.fn(ctx); err != nil {
+			return fmt.Errorf("启动钩子%s执行失败:%w", hook.name, err)
+		}
+	}
+	l.SetReady(true)
+	return nil
+}
+
+// Ready 是否处于就绪状态，健康检查使用
+func (l *Lifecycle) Ready() bool {
+	return atomic.LoadInt32(&l.ready) == 1
+}
+
+// SetReady 设置就绪状态
+func (l *Lifecycle) SetReady(ready bool) {
+	var val int32
+	if ready {
+		val = 1
+	}
+	atomic.StoreInt32(&l.ready, val)
+}
+
+// Restarting 是否因平滑重启而停止，此时新进程已接管监听，不应从注册中心注销
+func (l *Lifecycle) Restarting() bool {
+	return atomic.LoadInt32(&l.restarting) == 1
+}
+
+func (l *Lifecycle) setRestarting() {
+	atomic.StoreInt32(&l.restarting, 1)
+}
+
+// Done 所有停止钩子执行完毕后关闭
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// Stop 将就绪状态置为false，然后按优先级执行所有停止钩子，只会执行一次
+// 每个钩子在各自的超时时间内执行，超时或失败不影响后续钩子
+// 平滑重启时新进程已在相同监听上提供服务，不修改就绪状态也不等待摘除流量
+func (l *Lifecycle) Stop() {
+	l.stopOnce.Do(func() {
+		now := time.Now()
+		if !l.Restarting() {
+			l.SetReady(false)
+			if l.DrainDelay > 0 {
+				time.Sleep(l.DrainDelay)
+			}
+		}
+		for _, hook := range l.sortedHooks(true) {
+			timeout := hook.timeout
+			if timeout == 0 {
+				timeout = l.StopTimeout
+			}
+			hookStart := time.Now()
+			if err := l.runStop(hook, timeout); err != nil {
+				lifecycleLog(fmt.Sprintf("停止钩子%s执行失败:%s", hook.name, err.Error()))
+			} else {
+				lifecycleLog(fmt.Sprintf("停止钩子%s执行完毕,耗时:%s", hook.name, time.Since(hookStart)))
+			}
+		}
+		lifecycleLog(fmt.Sprintf("应用已停止,耗时:%s", time.Since(now)))
+		close(l.done)
+	})
+}
+
+// runStop 执行停止钩子，钩子未在超时时间内返回时不再等待
+func (l *Lifecycle) runStop(hook lifecycleHook, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				errCh <- fmt.Errorf("panic:%v", e)
+			}
+		}()
+		errCh <- hook.fn(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait 阻塞等待退出信号，收到信号后执行Stop，默认监听SIGTERM、SIGQUIT、SIGINT
+func (l *Lifecycle) Wait(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	select {
+	case sig := <-ch:
+		lifecycleLog(fmt.Sprintf("got a signal %s", sig))
+		l.Stop()
+	case <-l.done:
+	}
+}
+
+func (l *Lifecycle) sortedHooks(stop bool) []lifecycleHook {
+	l.lock.Lock()
+	hooks := l.starts
+	if stop {
+		hooks = l.stops
+	}
+	res := make([]lifecycleHook, len(hooks))
+	copy(res, hooks)
+	l.lock.Unlock()
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].priority < res[j].priority
+	})
+	return res
+}
+
+// lifecycleLog 停止过程中Logger可能已被刷新关闭，使用标准日志输出
+func lifecycleLog(msg string) {
+	log.Println("[lifecycle] " + msg)
+}
@@ -2,6 +2,7 @@ package ginlib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -15,15 +16,20 @@ import (
 	"os/signal"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 var (
 	Logger *zap.Logger
+
+	logRotateSig int32 //日志切割使用的信号，平滑重启不再响应该信号
 )
 
 // InitLogger 初始化日志文件
+// rotateSig 收到该信号后切割日志，使用SIGHUP时平滑重启只响应SIGUSR2
 func InitLogger(rotateSig ...syscall.Signal) *zap.Logger {
 	log.Println("初始化日志文件")
 	//log.path 使用","表示多个日志文件；stdout:输出到stdout
@@ -36,6 +42,10 @@ func InitLogger(rotateSig ...syscall.Signal) *zap.Logger {
 	logCompress := Ini_Bool("log.compress", false)
 
 	Logger = CreateLogger(logPath, loglevel, logEncode, logCompress, rotateSig...)
+	logger := Logger
+	DefaultLifecycle.OnStop("logger", StopPriorityLogger, func(ctx context.Context) error {
+		return logger.Sync()
+	})
 
 	return Logger
 }
@@ -64,6 +74,7 @@ func CreateLogger(logPath, loglevel, logEncode string, logCompress bool, rotateS
 			if len(rotateSig) > 0 {
 				sigs := make(chan os.Signal, 1)
 				signal.Notify(sigs, rotateSig[0])
+				atomic.StoreInt32(&logRotateSig, int32(rotateSig[0]))
 				go func() {
 					for _ = range sigs {
 						hook.Rotate()
@@ -119,11 +130,26 @@ func CreateLogger(logPath, loglevel, logEncode string, logCompress bool, rotateS
 }
 
 var (
+	larkLock     sync.Mutex
 	larkLastTime = make(map[string]time.Time)
 )
 
-// LarkNotice 通知消息
+// LarkNotice 通知消息，同一target一分钟内只发送一次
 func LarkNotice(target string, texts ...string) {
+	larkLock.Lock()
+	if time.Now().Sub(larkLastTime[target]) < time.Minute {
+		larkLock.Unlock()
+		return
+	}
+	larkLastTime[target] = time.Now()
+	larkLock.Unlock()
+	if err := larkSend(target, texts...); err != nil {
+		Logger.Error("通知lark失败", zap.Error(err))
+	}
+}
+
+// larkSend 发送lark通知，不限制频率
+func larkSend(target string, texts ...string) error {
 	targetHooks := map[string]string{
 		"system": "https://open.larksuite.com/open-apis/bot/v2/hook/94341b5b-0f3c-4f18-9e3b-d794973563cc",
 		"data":   "https://open.larksuite.com/open-apis/bot/v2/hook/94341b5b-0f3c-4f18-9e3b-d794973563cc",
@@ -134,8 +160,7 @@ func LarkNotice(target string, texts ...string) {
 	}
 	botHook := targetHooks[target]
 	if botHook == "" {
-		Logger.Error("无该target的hook地址", zap.String("target", target))
-		return
+		return fmt.Errorf("无该target的hook地址:%s", target)
 	}
 	contents := make([]interface{}, 0)
 	texts = append([]string{fmt.Sprintf("项目环境: %s", GetEnv())}, texts...)
@@ -147,11 +172,6 @@ func LarkNotice(target string, texts ...string) {
 			},
 		})
 	}
-	//一分钟内只触发一次
-	if time.Now().Sub(larkLastTime[target]) < time.Minute {
-		return
-	}
-	larkLastTime[target] = time.Now()
 	param := gin.H{
 		"msg_type": "post",
 		"content": gin.H{
@@ -166,14 +186,15 @@ func LarkNotice(target string, texts ...string) {
 	paramJson, _ := json.Marshal(param)
 	req, err := http.NewRequest("POST", botHook, bytes.NewReader(paramJson))
 	if err != nil {
-		Logger.Error("通知lark失败", zap.Error(err))
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		Logger.Error("通知lark失败", zap.Error(err))
+		return err
 	}
 	defer resp.Body.Close()
 	raw, _ := io.ReadAll(resp.Body)
 	Logger.Debug("发送lark通知", zap.ByteString("raw", raw), zap.String("botHook", botHook))
+	return nil
 }
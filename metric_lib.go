@@ -0,0 +1,170 @@
+package ginlib
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	//MetricRequestDuration 请求耗时，MiddleRequestMetric仍会更新，兼容已有的监控面板与告警
+	//Deprecated: 以请求路径为标签会产生大量序列，将在后续版本移除，使用<namespace>_http_request_duration
+	MetricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration",
+		Buckets: []float64{10, 20, 30, 40, 50, 60, 70, 100, 200, 500},
+	}, []string{"path", "code"})
+
+	metricNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	defaultRequestMetricOnce sync.Once
+	defaultRequestMetric     gin.HandlerFunc
+)
+
+// RequestMetricConfig 请求指标配置
+type RequestMetricConfig struct {
+	Namespace       string                //指标前缀，默认使用APP_NAME
+	DurationBuckets []float64             //耗时分布(毫秒)，默认10,20,30,40,50,60,70,100,200,500
+	SizeBuckets     []float64             //请求与响应大小分布(字节)，默认100B到10M
+	Registerer      prometheus.Registerer //默认prometheus.DefaultRegisterer
+}
+
+// MiddleRequestMetric 请求指标计算，使用默认配置，首次请求时创建指标，此时需已调用InitIni
+// 流式响应的持续时间由<namespace>_http_stream_duration_seconds统计
+// 弃用期内同时更新MetricRequestDuration
+func MiddleRequestMetric(c *gin.Context) {
+	defaultRequestMetricOnce.Do(func() {
+		defaultRequestMetric = MiddleRequestMetricWithConfig(RequestMetricConfig{})
+	})
+	start := time.Now()
+	defaultRequestMetric(c)
+	MetricRequestDuration.WithLabelValues(c.Request.URL.Path, strconv.Itoa(c.Writer.Status())).Observe(float64(time.Since(start).Milliseconds()))
+}
+
+// MiddleRequestMetricWithConfig 请求指标计算，以路由模板与请求方法为标签，避免路径参数产生大量序列
+// <namespace>_http_request_duration 耗时(毫秒)，标签method、route、status、error_code
+// <namespace>_http_requests_in_flight 处理中的请求数，标签method、route
+// <namespace>_http_request_size_bytes 请求体大小，标签method、route
+// <namespace>_http_response_size_bytes 响应体大小，标签method、route、status
+// 未匹配路由的请求route为unmatched，error_code为JsonRender返回的业务错误码，非json响应为空
+func MiddleRequestMetricWithConfig(conf RequestMetricConfig) gin.HandlerFunc {
+	conf.Namespace = metricNamespace(conf.Namespace)
+	if len(conf.DurationBuckets) == 0 {
+		conf.DurationBuckets = []float64{10, 20, 30, 40, 50, 60, 70, 100, 200, 500}
+	}
+	if len(conf.SizeBuckets) == 0 {
+		conf.SizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+	}
+	if conf.Registerer == nil {
+		conf.Registerer = prometheus.DefaultRegisterer
+	}
+
+	duration := metricRegister(conf.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: conf.Namespace,
+		Name:      "http_request_duration",
+		Buckets:   conf.DurationBuckets,
+	}, []string{"method", "route", "status", "error_code"})).(*prometheus.HistogramVec)
+	inFlight := metricRegister(conf.Registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: conf.Namespace,
+		Name:      "http_requests_in_flight",
+	}, []string{"method", "route"})).(*prometheus.GaugeVec)
+	reqSize := metricRegister(conf.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: conf.Namespace,
+		Name:      "http_request_size_bytes",
+		Buckets:   conf.SizeBuckets,
+	}, []string{"method", "route"})).(*prometheus.HistogramVec)
+	respSize := metricRegister(conf.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: conf.Namespace,
+		Name:      "http_response_size_bytes",
+		Buckets:   conf.SizeBuckets,
+	}, []string{"method", "route", "status"})).(*prometheus.HistogramVec)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		method := c.Request.Method
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		flight := inFlight.WithLabelValues(method, route)
+		flight.Inc()
+		defer flight.Dec()
+		if c.Request.ContentLength > 0 {
+			reqSize.WithLabelValues(method, route).Observe(float64(c.Request.ContentLength))
+		} else {
+			reqSize.WithLabelValues(method, route).Observe(0)
+		}
+
+		c.Next()
+
+		status := strconv.Itoa(c.Writer.Status())
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		respSize.WithLabelValues(method, route, status).Observe(float64(size))
+		if streamStatOf(c) != nil {
+			return
+		}
+		errorCode := ""
+		if code, ok := (&Context{c}).ErrorCode(); ok {
+			errorCode = strconv.Itoa(code)
+		}
+		duration.WithLabelValues(method, route, status, errorCode).Observe(float64(time.Since(start).Milliseconds()))
+	}
+}
+
+// metricNamespace 指标前缀，为空时使用APP_NAME，APP_NAME也为空时使用ginlib，避免与无前缀的指标重名
+func metricNamespace(namespace string) string {
+	if namespace == "" {
+		namespace = APP_NAME
+	}
+	if namespace == "" {
+		namespace = "ginlib"
+	}
+	return metricNamePattern.ReplaceAllString(namespace, "_")
+}
+
+// metricLazy 以APP_NAME为前缀的指标，首次使用时创建并注册到prometheus.DefaultRegisterer，此时需已调用InitIni
+type metricLazy struct {
+	once      sync.Once
+	create    func(namespace string) prometheus.Collector
+	collector prometheus.Collector
+}
+
+func newMetricLazy(create func(namespace string) prometheus.Collector) *metricLazy {
+	return &metricLazy{create: create}
+}
+
+func (m *metricLazy) get() prometheus.Collector {
+	m.once.Do(func() {
+		m.collector = metricRegister(prometheus.DefaultRegisterer, m.create(metricNamespace("")))
+	})
+	return m.collector
+}
+
+func (m *metricLazy) counter() *prometheus.CounterVec {
+	return m.get().(*prometheus.CounterVec)
+}
+
+func (m *metricLazy) gauge() *prometheus.GaugeVec {
+	return m.get().(*prometheus.GaugeVec)
+}
+
+func (m *metricLazy) histogram() *prometheus.HistogramVec {
+	return m.get().(*prometheus.HistogramVec)
+}
+
+// metricRegister 注册指标，已注册过相同指标时返回已注册的指标
+func metricRegister(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
@@ -3,7 +3,6 @@ package ginlib
 import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"net/http"
 )
 
 //AuthWare 认证拦截
@@ -12,7 +11,7 @@ func AuthWare(c *gin.Context)  {
 
 	jwtToken := c.GetHeader("Authorization")
 	if len(jwtToken) < 7{
-		this.JsonReturn(5003, nil, "请先登录")
+		this.JsonError(ErrNotLogin.New())
 		this.Abort()
 		return
 	}
@@ -20,33 +19,24 @@ func AuthWare(c *gin.Context)  {
 	jwtSecret := Ini_Str("auth.jwt_secret")
 	if uid, err := JwtAuthUid(jwtToken, jwtSecret); err != nil {
 		Logger.Debug("登录失败", zap.Error(err), zap.String("jwtToken", jwtToken), zap.String("jwtSecret", jwtSecret))
-		this.JsonReturn(5003, nil, "请先登录")
+		this.JsonError(ErrNotLogin.New())
 		this.Abort()
 		return
 	} else {
 		this.Set("uid", int64(uid))
+		requestMetaSetUid(c, int64(uid))
 	}
 
 	c.Next()
 }
 
 
-//Cors 处理跨域请求,支持options访问
+//Cors 处理跨域请求,允许所有来源但不携带cookie,支持options访问
+//需携带cookie、限制来源或按路由配置时使用CorsWithConfig或NewCorsPolicy并配置来源白名单
 func Cors() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		method := c.Request.Method
-
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token, Authorization, Token")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		//放行所有OPTIONS方法
-		if method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-		}
-		// 处理请求
-		c.Next()
-	}
+	return CorsWithConfig(CorsConfig{
+		AllowOrigins:  []string{"*"},
+		AllowHeaders:  []string{"Content-Type", "AccessToken", "X-CSRF-Token", "Authorization", "Token", RequestIDHeader, IdempotencyHeader},
+		ExposeHeaders: []string{"Content-Length", "Content-Type", RequestIDHeader},
+	})
 }
@@ -12,6 +12,7 @@ import (
 	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 	"go.uber.org/zap"
 	"runtime"
+	"strings"
 )
 
 var (
@@ -38,24 +39,27 @@ func MongoDBCreate(ctx context.Context, connUri string, showLog bool) *mongo.Dat
 	}
 	clientOps := options.Client().ApplyURI(connUri)
 
-	//定义日志
-	if showLog {
-		clientOps = clientOps.SetLoggerOptions(&options.LoggerOptions{
-			ComponentLevels: map[options.LogComponent]options.LogLevel{
-				options.LogComponentCommand: options.LogLevelDebug,
-			},
-			Sink:              MongoSink{},
-			MaxDocumentLength: 2048,
-		})
-	}
-
 	//增加监控
+	//showLog时通过LoggerFrom(ctx)记录命令日志，使用带请求id的ctx调用时日志带有请求id
 	clientOps = clientOps.SetMonitor(&event.CommandMonitor{
-		Started: nil,
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			if !showLog || evt.CommandName == "ping" {
+				return
+			}
+			LoggerFrom(ctx).Info("[Mongo]Command started",
+				zap.String("db", evt.DatabaseName),
+				zap.String("command", evt.CommandName),
+				zap.Int64("requestId", evt.RequestID),
+				zap.String("body", Substr(evt.Command.String(), 0, 2048)),
+			)
+		},
 		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
 			if evt.CommandName == "ping" {
 				return
 			}
+			if showLog {
+				LoggerFrom(ctx).Info("[Mongo]Command succeeded", zap.String("command", evt.CommandName), zap.Int64("requestId", evt.RequestID), zap.Duration("cost", evt.Duration))
+			}
 			_, file, line, ok := runtime.Caller(6)
 			if ok {
 				path := fmt.Sprintf("%s:%d", file, line)
@@ -66,6 +70,9 @@ func MongoDBCreate(ctx context.Context, connUri string, showLog bool) *mongo.Dat
 			if evt.CommandName == "ping" {
 				return
 			}
+			if showLog {
+				LoggerFrom(ctx).Error("[Mongo]Command failed", zap.String("command", evt.CommandName), zap.Int64("requestId", evt.RequestID), zap.Duration("cost", evt.Duration), zap.String("failure", evt.Failure))
+			}
 			_, file, line, ok := runtime.Caller(6)
 			if ok {
 				path := fmt.Sprintf("%s:%d", file, line)
@@ -82,10 +89,15 @@ func MongoDBCreate(ctx context.Context, connUri string, showLog bool) *mongo.Dat
 		panic("MongoDB链接失败")
 	}
 
+	DefaultLifecycle.OnStop(fmt.Sprintf("mongo %s/%s(%p)", strings.Join(cs.Hosts, ","), cs.Database, client), StopPriorityDB, client.Disconnect)
+
 	mongoDb := client.Database(cs.Database)
 	return mongoDb
 }
 
+// MongoSink mongo驱动日志
+//
+// Deprecated: 日志中没有请求id，MongoDBCreate已改为通过命令监控记录带请求id的日志，保留仅为兼容
 type MongoSink struct {
 }
 
@@ -1,12 +1,15 @@
 package ginlib
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
+	"gorm.io/gorm/utils"
 	"strings"
 	"time"
 )
@@ -17,12 +20,7 @@ func MysqlDBCreate(dsn string, maxOpenConn, maxIdleConn, maxLifeSecond int, show
 		NamingStrategy: schema.NamingStrategy{
 			SingularTable: true,
 		},
-		Logger: logger.New(GormLogger{showLog}, logger.Config{
-			SlowThreshold:             time.Second,
-			LogLevel:                  logger.Info,
-			IgnoreRecordNotFoundError: true,  // Ignore ErrRecordNotFound error for logger
-			Colorful:                  false, // Disable color
-		}),
+		Logger: NewGormCtxLogger(showLog),
 	})
 	if err != nil {
 		panic(err)
@@ -31,11 +29,26 @@ func MysqlDBCreate(dsn string, maxOpenConn, maxIdleConn, maxLifeSecond int, show
 	sqlDb.SetMaxOpenConns(maxOpenConn)
 	sqlDb.SetMaxIdleConns(maxIdleConn)
 	sqlDb.SetConnMaxLifetime(time.Second * time.Duration(maxLifeSecond))
+	//同一地址可能创建多个连接池，名称带上连接池地址，避免互相替换停止钩子
+	DefaultLifecycle.OnStop(fmt.Sprintf("mysql %s(%p)", mysqlDsnAddr(dsn), sqlDb), StopPriorityDB, func(ctx context.Context) error {
+		return sqlDb.Close()
+	})
 
 	return eng
 }
 
-// GormLogger 定义gorm日志
+// mysqlDsnAddr dsn中的地址与库名，不含账号密码，如tcp(127.0.0.1:3306)/test
+func mysqlDsnAddr(dsn string) string {
+	if idx := strings.LastIndex(dsn, "@"); idx >= 0 {
+		dsn = dsn[idx+1:]
+	}
+	if idx := strings.Index(dsn, "?"); idx >= 0 {
+		dsn = dsn[:idx]
+	}
+	return dsn
+}
+
+// GormLogger 定义gorm日志，日志中没有请求id，建议使用GormCtxLogger
 type GormLogger struct {
 	ShowLog bool
 }
@@ -48,3 +61,61 @@ func (this GormLogger) Printf(format string, v ...interface{}) {
 	v[0] = "MYSQL"
 	Logger.WithOptions(zap.AddCallerSkip(4)).Info(fmt.Sprintf(format, v...))
 }
+
+// GormCtxLogger gorm日志，通过LoggerFrom(ctx)记录，使用db.WithContext(ctx)时日志带有请求id
+type GormCtxLogger struct {
+	ShowLog       bool
+	SlowThreshold time.Duration
+	LogLevel      logger.LogLevel
+}
+
+// NewGormCtxLogger 创建gorm日志，慢查询阈值1秒，忽略记录不存在错误
+func NewGormCtxLogger(showLog bool) logger.Interface {
+	return &GormCtxLogger{ShowLog: showLog, SlowThreshold: time.Second, LogLevel: logger.Info}
+}
+
+func (l *GormCtxLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.LogLevel = level
+	return &newLogger
+}
+
+func (l *GormCtxLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.ShowLog && l.LogLevel >= logger.Info {
+		LoggerFrom(ctx).Info("MYSQL "+fmt.Sprintf(msg, data...), zap.String("source", utils.FileWithLineNum()))
+	}
+}
+
+func (l *GormCtxLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.ShowLog && l.LogLevel >= logger.Warn {
+		LoggerFrom(ctx).Warn("MYSQL "+fmt.Sprintf(msg, data...), zap.String("source", utils.FileWithLineNum()))
+	}
+}
+
+func (l *GormCtxLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.ShowLog && l.LogLevel >= logger.Error {
+		LoggerFrom(ctx).Error("MYSQL "+fmt.Sprintf(msg, data...), zap.String("source", utils.FileWithLineNum()))
+	}
+}
+
+func (l *GormCtxLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if !l.ShowLog || l.LogLevel <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+	fields := []zap.Field{
+		zap.String("source", utils.FileWithLineNum()),
+		zap.Duration("cost", elapsed),
+		zap.Int64("rows", rows),
+		zap.String("sql", sql),
+	}
+	switch {
+	case err != nil && l.LogLevel >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		LoggerFrom(ctx).Error("MYSQL", append(fields, zap.Error(err))...)
+	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold && l.LogLevel >= logger.Warn:
+		LoggerFrom(ctx).Warn(fmt.Sprintf("MYSQL SLOW SQL >= %v", l.SlowThreshold), fields...)
+	case l.LogLevel >= logger.Info:
+		LoggerFrom(ctx).Info("MYSQL", fields...)
+	}
+}
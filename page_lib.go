@@ -0,0 +1,272 @@
+package ginlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+const (
+	ctxKeyPage       = "ginlib.page"
+	ctxKeyPageCursor = "ginlib.page_cursor"
+)
+
+var (
+	PageParamName     = "page"      //页码参数名
+	PageSizeParamName = "page_size" //每页条数参数名
+	CursorParamName   = "cursor"    //游标参数名
+	PageDefaultSize   = 20          //默认每页条数
+	PageMaxSize       = 100         //每页最大条数
+	PageMaxPage       = 10000       //最大页码，避免偏移量过大或溢出
+)
+
+// PageSpec 分页参数
+type PageSpec struct {
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// Offset 分页偏移量
+func (p PageSpec) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// PageResult 标准分页返回结构
+type PageResult struct {
+	List     interface{} `json:"list"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+// CursorSpec 游标分页参数，Cursor为空表示第一页
+type CursorSpec struct {
+	Cursor   string `json:"cursor"`
+	PageSize int    `json:"page_size"`
+}
+
+// Value 解码游标中的值
+func (p CursorSpec) Value() (val interface{}, err error) {
+	if p.Cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, ErrorI18nNew("参数%s格式错误", CursorParamName)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err = dec.Decode(&val); err != nil {
+		return nil, ErrorI18nNew("参数%s格式错误", CursorParamName)
+	}
+	//数字游标转换为int64或float64，便于数据库比较
+	if num, ok := val.(json.Number); ok {
+		if t, e := num.Int64(); e == nil {
+			return t, nil
+		}
+		return num.Float64()
+	}
+	return val, nil
+}
+
+// CursorResult 游标分页返回结构
+type CursorResult struct {
+	List       interface{} `json:"list"`
+	NextCursor string      `json:"next_cursor"`
+	HasMore    bool        `json:"has_more"`
+	PageSize   int         `json:"page_size"`
+}
+
+// CursorEncode 将最后一条数据的排序字段值编码为游标
+func CursorEncode(val interface{}) string {
+	raw, _ := json.Marshal(val)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Page 获取经过校验的分页参数，页码从1开始
+// maxSize 可选，覆盖PageMaxSize；参数格式错误时记录到InputErrors并使用默认值
+// 页码超过PageMaxPage时记录到InputErrors并使用PageMaxPage
+func (c *Context) Page(maxSize ...int) PageSpec {
+	limit := PageMaxSize
+	if len(maxSize) > 0 && maxSize[0] > 0 {
+		limit = maxSize[0]
+	}
+	page, err := c.InputIntE(PageParamName, 1)
+	c.InputErrorAdd(err)
+	size, err := c.InputIntE(PageSizeParamName, PageDefaultSize)
+	c.InputErrorAdd(err)
+
+	spec := PageSpec{Page: page, PageSize: pageSizeClamp(size, limit)}
+	if spec.Page < 1 {
+		spec.Page = 1
+	}
+	if spec.Page > PageMaxPage {
+		c.InputErrorAdd(FieldError{PageParamName, ErrorI18nNew("参数%s不能大于%v", PageParamName, PageMaxPage)})
+		spec.Page = PageMaxPage
+	}
+	c.Set(ctxKeyPage, spec)
+	return spec
+}
+
+// PageCursor 获取经过校验的游标分页参数
+func (c *Context) PageCursor(maxSize ...int) CursorSpec {
+	limit := PageMaxSize
+	if len(maxSize) > 0 && maxSize[0] > 0 {
+		limit = maxSize[0]
+	}
+	size, err := c.InputIntE(PageSizeParamName, PageDefaultSize)
+	c.InputErrorAdd(err)
+	spec := CursorSpec{
+		Cursor:   c.InputStr(CursorParamName),
+		PageSize: pageSizeClamp(size, limit),
+	}
+	c.Set(ctxKeyPageCursor, spec)
+	return spec
+}
+
+// JsonPage 返回标准分页结构{list,total,page,page_size}
+func (c *Context) JsonPage(list interface{}, total int64) {
+	spec, ok := c.Get(ctxKeyPage)
+	if !ok {
+		spec = c.Page()
+	}
+	p := spec.(PageSpec)
+	c.JsonSucc(PageResult{
+		List:     pageList(list),
+		Total:    total,
+		Page:     p.Page,
+		PageSize: p.PageSize,
+	})
+}
+
+// JsonCursor 返回游标分页结构，list需要先经过CursorTrim处理，nextCursor为空表示没有下一页
+func (c *Context) JsonCursor(list interface{}, nextCursor string) {
+	spec, ok := c.Get(ctxKeyPageCursor)
+	if !ok {
+		spec = c.PageCursor()
+	}
+	c.JsonSucc(CursorResult{
+		List:       pageList(list),
+		NextCursor: nextCursor,
+		HasMore:    nextCursor != "",
+		PageSize:   spec.(CursorSpec).PageSize,
+	})
+}
+
+// PageScope gorm分页scope，用法: db.Scopes(ginlib.PageScope(p)).Find(&list)
+func PageScope(p PageSpec) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset(p.Offset()).Limit(p.PageSize)
+	}
+}
+
+// PageFind 使用gorm查询总数和当前页数据，db需要已指定Model或Table以及查询条件
+func PageFind(db *gorm.DB, p PageSpec, dest interface{}) (total int64, err error) {
+	tx := db.Session(&gorm.Session{})
+	if err = tx.Count(&total).Error; err != nil || total == 0 {
+		return
+	}
+	err = tx.Scopes(PageScope(p)).Find(dest).Error
+	return
+}
+
+// CursorScope gorm游标分页scope，按column排序并取游标之后的数据
+// 会多查询一条数据用于判断是否还有下一页，查询结果需要经过CursorTrim处理
+func CursorScope(column string, p CursorSpec, desc bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		val, err := p.Value()
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		order := column + " ASC"
+		op := " > ?"
+		if desc {
+			order = column + " DESC"
+			op = " < ?"
+		}
+		if val != nil {
+			db = db.Where(column+op, val)
+		}
+		return db.Order(order).Limit(p.PageSize + 1)
+	}
+}
+
+// CursorTrim 裁剪游标分页多查询的一条数据，listPtr为切片指针，返回是否还有下一页
+func CursorTrim(listPtr interface{}, p CursorSpec) (hasMore bool) {
+	rv := reflect.ValueOf(listPtr)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		panic("CursorTrim的参数必须是切片指针")
+	}
+	rv = rv.Elem()
+	if rv.Len() <= p.PageSize {
+		return false
+	}
+	rv.Set(rv.Slice(0, p.PageSize))
+	return true
+}
+
+// PageFindOptions mongo分页查询参数
+func PageFindOptions(p PageSpec) *options.FindOptions {
+	return options.Find().SetSkip(int64(p.Offset())).SetLimit(int64(p.PageSize))
+}
+
+// MongoPageFind 使用mongo查询总数和当前页数据，opts可追加排序等查询参数
+func MongoPageFind(ctx context.Context, coll *mongo.Collection, filter interface{}, p PageSpec, dest interface{}, opts ...*options.FindOptions) (total int64, err error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if total, err = coll.CountDocuments(ctx, filter); err != nil || total == 0 {
+		return
+	}
+	cur, err := coll.Find(ctx, filter, append(opts, PageFindOptions(p))...)
+	if err != nil {
+		return
+	}
+	err = cur.All(ctx, dest)
+	return
+}
+
+// CursorFindOptions mongo游标分页，返回需要合并到查询条件中的filter以及查询参数
+// 会多查询一条数据用于判断是否还有下一页，查询结果需要经过CursorTrim处理
+func CursorFindOptions(field string, p CursorSpec, desc bool) (filter bson.M, opts *options.FindOptions, err error) {
+	val, err := p.Value()
+	if err != nil {
+		return
+	}
+	op, sort := "$gt", 1
+	if desc {
+		op, sort = "$lt", -1
+	}
+	filter = bson.M{}
+	if val != nil {
+		filter[field] = bson.M{op: val}
+	}
+	opts = options.Find().SetSort(bson.D{{Key: field, Value: sort}}).SetLimit(int64(p.PageSize + 1))
+	return
+}
+
+func pageSizeClamp(size, limit int) int {
+	if size < 1 {
+		size = PageDefaultSize
+	}
+	if size > limit {
+		size = limit
+	}
+	return size
+}
+
+// pageList 保证空列表返回[]而不是null
+func pageList(list interface{}) interface{} {
+	rv := reflect.ValueOf(list)
+	if list == nil || (rv.Kind() == reflect.Slice && rv.IsNil()) {
+		return []interface{}{}
+	}
+	return list
+}
@@ -0,0 +1,448 @@
+package ginlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RateLimitTokenBucket   = "token_bucket"   //令牌桶，允许Burst的突发请求
+	RateLimitSlidingWindow = "sliding_window" //滑动窗口，Window内最多Limit个请求
+
+	RateLimitKeyIP    = "ip"    //按客户端ip限流，默认使用连接的ip，来自可信代理的请求使用X-Forwarded-For中的ip
+	RateLimitKeyUid   = "uid"   //按AuthWare设置的uid限流，未登录时按ip
+	RateLimitKeyRoute = "route" //按路由整体限流
+)
+
+var (
+	ErrTooManyRequests = BizErrorRegister(4290, "请求过于频繁,请稍后再试", http.StatusTooManyRequests, zapcore.InfoLevel)
+
+	//metricRateLimitRejected 被限流的请求数，<namespace>_ratelimit_rejected_total
+	metricRateLimitRejected = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ratelimit_rejected_total",
+		}, []string{"rule"})
+	})
+)
+
+// RateLimitRule 限流规则
+type RateLimitRule struct {
+	Name      string        `json:"name"`      //规则名称，用于存储key与指标，默认method+route:key:algorithm:limit/window
+	Route     string        `json:"route"`     //路由模板，如/user/:id，*表示所有路由，以*结尾时按前缀匹配，匹配到的路由共享限额
+	Method    string        `json:"method"`    //请求方法，为空时匹配所有方法
+	Key       string        `json:"key"`       //限流维度ip、uid、route或WithRateLimitKey注册的名称，默认ip
+	Algorithm string        `json:"algorithm"` //token_bucket或sliding_window，默认sliding_window
+	Limit     int           `json:"limit"`     //Window内允许的请求数，令牌桶为每Window补充的令牌数
+	Window    time.Duration `json:"-"`         //时间窗口
+	Burst     int           `json:"burst"`     //令牌桶容量，默认Limit
+}
+
+// rateLimitRuleJson 配置中的规则，window使用1s、1m这类时长
+type rateLimitRuleJson struct {
+	RateLimitRule
+	Window string `json:"window"`
+}
+
+// ParseRateLimitRules 解析json格式的限流规则
+// [{"route":"/login","method":"POST","key":"ip","algorithm":"sliding_window","limit":5,"window":"1m"}]
+func ParseRateLimitRules(raw string) ([]RateLimitRule, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	items := make([]rateLimitRuleJson, 0)
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return nil, fmt.Errorf("限流规则格式错误:%w", err)
+	}
+	rules := make([]RateLimitRule, 0, len(items))
+	for _, val := range items {
+		window, err := time.ParseDuration(val.Window)
+		if err != nil {
+			return nil, fmt.Errorf("限流规则%s的window格式错误:%w", val.Route, err)
+		}
+		val.RateLimitRule.Window = window
+		rules = append(rules, val.RateLimitRule)
+	}
+	return rules, nil
+}
+
+// RateLimitStore 限流计数存储
+type RateLimitStore interface {
+	// Allow 记录一次请求，超出限制时返回false以及建议的重试间隔
+	Allow(key string, rule RateLimitRule) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitKeyFunc 自定义限流维度，返回空时不限流
+type RateLimitKeyFunc func(c *Context) string
+
+// RateLimiter 限流器，规则可在运行中替换
+type RateLimiter struct {
+	store          RateLimitStore
+	rules          atomic.Value
+	keyFuncs       map[string]RateLimitKeyFunc
+	trustedProxies []*net.IPNet
+}
+
+type RateLimitOption func(l *RateLimiter)
+
+// WithRateLimitKey 注册自定义限流维度，规则中key使用name
+func WithRateLimitKey(name string, fn RateLimitKeyFunc) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.keyFuncs[name] = fn
+	}
+}
+
+// WithRateLimitTrustedProxies 设置可信代理的ip或CIDR，如10.0.0.0/8，配置错误时panic
+// 只有连接来自可信代理时才使用X-Forwarded-For、X-Real-IP中的客户端ip，避免伪造请求头绕过按ip限流
+func WithRateLimitTrustedProxies(proxies ...string) RateLimitOption {
+	return func(l *RateLimiter) {
+		for _, val := range proxies {
+			val = strings.TrimSpace(val)
+			if !strings.Contains(val, "/") {
+				if ip := net.ParseIP(val); ip != nil && ip.To4() != nil {
+					val += "/32"
+				} else {
+					val += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(val)
+			if err != nil {
+				panic(fmt.Errorf("限流可信代理配置错误:%w", err))
+			}
+			l.trustedProxies = append(l.trustedProxies, ipNet)
+		}
+	}
+}
+
+// WithRateLimitRules 设置初始规则
+func WithRateLimitRules(rules ...RateLimitRule) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.SetRules(rules)
+	}
+}
+
+// NewRateLimiter 创建限流器，store为nil时使用进程内存储
+func NewRateLimiter(store RateLimitStore, opts ...RateLimitOption) *RateLimiter {
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	l := &RateLimiter{store: store}
+	l.keyFuncs = map[string]RateLimitKeyFunc{
+		RateLimitKeyIP: l.clientIP,
+		RateLimitKeyUid: func(c *Context) string {
+			if uid := c.GetInt64("uid"); uid > 0 {
+				return "uid:" + strconv.FormatInt(uid, 10)
+			}
+			return l.clientIP(c)
+		},
+		RateLimitKeyRoute: func(c *Context) string {
+			return "all"
+		},
+	}
+	l.rules.Store([]RateLimitRule{})
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// SetRules 替换限流规则，并发安全
+func (l *RateLimiter) SetRules(rules []RateLimitRule) {
+	res := make([]RateLimitRule, 0, len(rules))
+	for _, val := range rules {
+		if val.Limit <= 0 || val.Window <= 0 {
+			continue
+		}
+		if val.Key == "" {
+			val.Key = RateLimitKeyIP
+		}
+		if val.Algorithm == "" {
+			val.Algorithm = RateLimitSlidingWindow
+		}
+		if val.Burst <= 0 {
+			val.Burst = val.Limit
+		}
+		if val.Name == "" {
+			//同一路由可叠加多条规则，如每分钟与每小时各一条，名称需包含算法与限额以免共享计数
+			val.Name = fmt.Sprintf("%s%s:%s:%s:%d/%s", val.Method, val.Route, val.Key, val.Algorithm, val.Limit, val.Window)
+		}
+		res = append(res, val)
+	}
+	l.rules.Store(res)
+}
+
+// Rules 当前的限流规则
+func (l *RateLimiter) Rules() []RateLimitRule {
+	return l.rules.Load().([]RateLimitRule)
+}
+
+// LoadIni 从ini中读取json格式的规则，key格式为section.key
+func (l *RateLimiter) LoadIni(key string) error {
+	rules, err := ParseRateLimitRules(Ini_Str(key))
+	if err != nil {
+		return err
+	}
+	l.SetRules(rules)
+	return nil
+}
+
+// WatchConfig 从阿波罗读取json格式的规则，配置变化后自动更新，更新失败时保留原规则
+func (l *RateLimiter) WatchConfig(key string) error {
+	load := func(key string) error {
+		rules, err := ParseRateLimitRules(ConfigVal(key))
+		if err != nil {
+			return err
+		}
+		l.SetRules(rules)
+		Logger.Info("限流规则已更新", zap.String("key", key), zap.Int("rules", len(rules)))
+		return nil
+	}
+	ConfigWatch(key, func(key string) {
+		if err := load(key); err != nil {
+			Logger.Error("限流规则更新失败", zap.String("key", key), zap.Error(err))
+		}
+	})
+	return load(key)
+}
+
+// Ware 限流中间件，超出限制时按JsonReturn格式返回ErrTooManyRequests并设置Retry-After
+// 存储出错时放行请求
+func (l *RateLimiter) Ware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		this := Context{c}
+		route := c.FullPath()
+		for _, rule := range l.Rules() {
+			if !rateLimitMatch(rule, c.Request.Method, route) {
+				continue
+			}
+			keyFunc := l.keyFuncs[rule.Key]
+			if keyFunc == nil {
+				continue
+			}
+			key := keyFunc(&this)
+			if key == "" {
+				continue
+			}
+			allowed, retryAfter, err := l.store.Allow(rule.Name+":"+key, rule)
+			if err != nil {
+				this.Log().Warn("限流存储出错", zap.String("rule", rule.Name), zap.Error(err))
+				continue
+			}
+			if !allowed {
+				metricRateLimitRejected.counter().WithLabelValues(rule.Name).Inc()
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				this.JsonError(ErrTooManyRequests.New())
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// clientIP 客户端ip，连接来自可信代理时从右向左取X-Forwarded-For中第一个不可信的ip
+func (l *RateLimiter) clientIP(c *Context) string {
+	remote := c.Request.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !l.trusted(remote) {
+		return remote
+	}
+	if forwarded := c.GetHeader("X-Forwarded-For"); forwarded != "" {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if i == 0 || !l.trusted(ip) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(c.GetHeader("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return remote
+}
+
+func (l *RateLimiter) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, val := range l.trustedProxies {
+		if val.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func rateLimitMatch(rule RateLimitRule, method, route string) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, method) {
+		return false
+	}
+	if rule.Route == "*" || rule.Route == route {
+		return true
+	}
+	return strings.HasSuffix(rule.Route, "*") && strings.HasPrefix(route, strings.TrimSuffix(rule.Route, "*"))
+}
+
+// memoryRateLimitStore 进程内限流存储，只对单实例生效
+type memoryRateLimitStore struct {
+	lock      sync.Mutex
+	items     map[string]*rateLimitState
+	lastClean time.Time
+}
+
+type rateLimitState struct {
+	tokens      float64   //令牌桶剩余令牌
+	windowStart time.Time //滑动窗口当前窗口开始时间
+	prevCount   int
+	currCount   int
+	updated     time.Time
+	window      time.Duration
+}
+
+// NewMemoryRateLimitStore 创建进程内限流存储
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{items: make(map[string]*rateLimitState), lastClean: time.Now()}
+}
+
+func (m *memoryRateLimitStore) Allow(key string, rule RateLimitRule) (bool, time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	//每分钟清理一次长时间未访问的计数
+	if now.Sub(m.lastClean) > time.Minute {
+		for k, val := range m.items {
+			if now.Sub(val.updated) > 2*val.window {
+				delete(m.items, k)
+			}
+		}
+		m.lastClean = now
+	}
+	state, ok := m.items[key]
+	if !ok {
+		state = &rateLimitState{tokens: float64(rule.Burst), windowStart: now, updated: now}
+		m.items[key] = state
+	}
+	state.window = rule.Window
+
+	if rule.Algorithm == RateLimitTokenBucket {
+		rate := float64(rule.Limit) / float64(rule.Window)
+		state.tokens = math.Min(float64(rule.Burst), state.tokens+float64(now.Sub(state.updated))*rate)
+		state.updated = now
+		if state.tokens < 1 {
+			return false, time.Duration((1 - state.tokens) / rate), nil
+		}
+		state.tokens--
+		return true, 0, nil
+	}
+
+	//滑动窗口计数：上一窗口的计数按时间比例折算后加上当前窗口计数
+	state.updated = now
+	elapsed := now.Sub(state.windowStart)
+	if elapsed >= rule.Window {
+		windows := elapsed / rule.Window
+		if windows == 1 {
+			state.prevCount = state.currCount
+		} else {
+			state.prevCount = 0
+		}
+		state.currCount = 0
+		state.windowStart = state.windowStart.Add(windows * rule.Window)
+		elapsed = now.Sub(state.windowStart)
+	}
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	if float64(state.prevCount)*weight+float64(state.currCount) >= float64(rule.Limit) {
+		return false, rule.Window - elapsed, nil
+	}
+	state.currCount++
+	return true, 0, nil
+}
+
+// redisRateLimitStore 基于redis的限流存储，多实例共享限额
+type redisRateLimitStore struct {
+	redisCli *redis.Client
+	prefix   string
+}
+
+// NewRedisRateLimitStore 创建基于redis的限流存储
+func NewRedisRateLimitStore(redisCli *redis.Client) RateLimitStore {
+	return &redisRateLimitStore{redisCli: redisCli, prefix: "ratelimit:"}
+}
+
+// 令牌桶 KEYS[1] ARGV: 每毫秒补充令牌数, 容量, 当前毫秒, 过期毫秒
+var rateLimitTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {allowed, retry}
+`)
+
+// 滑动窗口 KEYS[1] ARGV: 窗口毫秒, 限制数, 当前毫秒, 唯一成员
+var rateLimitWindowScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], 0, now - window)
+if redis.call("ZCARD", KEYS[1]) < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {1, 0}
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, tonumber(oldest[2]) + window - now}
+`)
+
+func (r *redisRateLimitStore) Allow(key string, rule RateLimitRule) (bool, time.Duration, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	windowMs := rule.Window.Milliseconds()
+	var res interface{}
+	var err error
+	if rule.Algorithm == RateLimitTokenBucket {
+		rate := float64(rule.Limit) / float64(windowMs)
+		ttl := int64(math.Ceil(float64(rule.Burst)/rate)) + 1000
+		res, err = rateLimitTokenScript.Run(r.redisCli, []string{r.prefix + key}, rate, rule.Burst, now, ttl).Result()
+	} else {
+		res, err = rateLimitWindowScript.Run(r.redisCli, []string{r.prefix + key}, windowMs, rule.Limit, now, UniqueId()).Result()
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return false, 0, fmt.Errorf("限流脚本返回格式错误:%v", res)
+	}
+	allowed, _ := vals[0].(int64)
+	retry, _ := vals[1].(int64)
+	return allowed == 1, time.Duration(retry) * time.Millisecond, nil
+}
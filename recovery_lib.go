@@ -0,0 +1,280 @@
+package ginlib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httputil"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	//metricPanicTotal panic次数，<namespace>_http_panic_total
+	metricPanicTotal = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_panic_total",
+		}, []string{"path", "fingerprint"})
+	})
+)
+
+// PanicEvent 一次panic的信息，Fingerprint相同的panic视为同一问题
+type PanicEvent struct {
+	Err         error
+	Stack       []byte
+	Fingerprint string    //根据panic位置的调用栈生成
+	Count       int64     //该Fingerprint累计发生次数
+	Suppressed  int64     //距上次上报期间未上报的次数
+	FirstSeen   time.Time //该Fingerprint首次发生时间
+	Method      string
+	Path        string
+	RequestID   string
+	Uid         int64
+	Request     string //请求头
+}
+
+// PanicReporter panic上报，如lark、sentry、邮件
+type PanicReporter interface {
+	Report(e PanicEvent)
+}
+
+// PanicReporterFunc 函数形式的PanicReporter
+type PanicReporterFunc func(e PanicEvent)
+
+func (f PanicReporterFunc) Report(e PanicEvent) {
+	f(e)
+}
+
+// PanicHandler 自定义panic时的响应
+type PanicHandler func(c *Context, e PanicEvent)
+
+// LarkPanicReporter 通过lark通知panic
+func LarkPanicReporter(target string) PanicReporter {
+	return PanicReporterFunc(func(e PanicEvent) {
+		err := larkSend(target,
+			fmt.Sprintf("错误描述:%s", e.Err.Error()),
+			fmt.Sprintf("指纹:%s 累计次数:%d 期间未通知次数:%d 首次发生:%s", e.Fingerprint, e.Count, e.Suppressed, e.FirstSeen.Format("2006-01-02 15:04:05")),
+			fmt.Sprintf("堆栈:\n%s", string(e.Stack)),
+			fmt.Sprintf("请求体:\n%s", e.Request),
+		)
+		if err != nil {
+			Logger.Error("通知lark失败", zap.Error(err))
+		}
+	})
+}
+
+type recovery struct {
+	stack     bool
+	reporters []PanicReporter
+	handler   PanicHandler
+	interval  time.Duration
+
+	lock   sync.Mutex
+	groups map[string]*panicGroup
+}
+
+type panicGroup struct {
+	count      int64
+	reported   int64
+	firstSeen  time.Time
+	lastReport time.Time
+}
+
+type RecoveryOption func(r *recovery)
+
+// WithPanicStack 日志中是否记录堆栈
+func WithPanicStack(stack bool) RecoveryOption {
+	return func(r *recovery) {
+		r.stack = stack
+	}
+}
+
+// WithPanicReporter 增加panic上报，可多次使用
+func WithPanicReporter(reporters ...PanicReporter) RecoveryOption {
+	return func(r *recovery) {
+		r.reporters = append(r.reporters, reporters...)
+	}
+}
+
+// WithPanicHandler 自定义panic时的响应，默认返回ErrSystem
+func WithPanicHandler(h PanicHandler) RecoveryOption {
+	return func(r *recovery) {
+		r.handler = h
+	}
+}
+
+// WithPanicReportInterval 同一Fingerprint的上报间隔，默认1分钟，间隔内的panic只计数不上报
+func WithPanicReportInterval(d time.Duration) RecoveryOption {
+	return func(r *recovery) {
+		r.interval = d
+	}
+}
+
+// GinRecovery 接受gin框架http中panic的错误
+// stack 日志中是否记录堆栈，notice 是否通过lark通知
+func GinRecovery(stack, notice bool) gin.HandlerFunc {
+	opts := []RecoveryOption{WithPanicStack(stack)}
+	if notice {
+		opts = append(opts, WithPanicReporter(LarkPanicReporter("system")))
+	}
+	return GinRecoveryWithOptions(opts...)
+}
+
+// GinRecoveryWithOptions 可配置上报与响应的panic恢复
+// 按调用栈为panic生成指纹，同一指纹在上报间隔内只上报一次，上报时带上累计次数
+func GinRecoveryWithOptions(opts ...RecoveryOption) gin.HandlerFunc {
+	r := &recovery{
+		interval: time.Minute,
+		groups:   make(map[string]*panicGroup),
+		handler: func(c *Context, e PanicEvent) {
+			c.JsonRender(c.errorResp(ErrSystem.New()))
+		},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return func(c *gin.Context) {
+		defer func() {
+			if e := recover(); e != nil {
+				//客户端断开等由net/http处理
+				if e == http.ErrAbortHandler {
+					panic(e)
+				}
+				r.recover(c, e)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func (r *recovery) recover(c *gin.Context, e interface{}) {
+	stack, fingerprint := []byte(nil), ""
+	if hp, ok := e.(handlerPanic); ok {
+		e, stack, fingerprint = hp.value, hp.stack, hp.fingerprint
+	} else {
+		stack, fingerprint = debug.Stack(), panicFingerprint()
+	}
+	var err error
+	switch v := e.(type) {
+	case error:
+		err = v
+	default:
+		err = fmt.Errorf("%v", v)
+	}
+	this := Context{c}
+	httpRequest, _ := httputil.DumpRequest(c.Request, false)
+	evt := PanicEvent{
+		Err:         err,
+		Stack:       stack,
+		Fingerprint: fingerprint,
+		Method:      c.Request.Method,
+		Path:        c.Request.URL.Path,
+		RequestID:   this.RequestID(),
+		Uid:         c.GetInt64("uid"),
+		Request:     string(httpRequest),
+	}
+	report := r.count(&evt)
+	metricPanicTotal.counter().WithLabelValues(c.FullPath(), evt.Fingerprint).Inc()
+
+	//记录日志
+	fields := []zap.Field{
+		zap.Any("error", err),
+		zap.String("request", evt.Request),
+		zap.String("fingerprint", evt.Fingerprint),
+		zap.Int64("count", evt.Count),
+	}
+	if r.stack {
+		fields = append(fields, zap.StackSkip("track", 3))
+	}
+	this.Log().Error("[Recovery from panic] path:"+evt.Path, fields...)
+
+	//返回错误，已开始输出响应时无法再返回
+	if !c.Writer.Written() {
+		r.handler(&this, evt)
+	}
+	c.Abort()
+
+	if report && len(r.reporters) > 0 {
+		go r.report(evt)
+	}
+}
+
+// count 统计同一指纹的次数，返回是否需要上报
+func (r *recovery) count(evt *PanicEvent) bool {
+	now := time.Now()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	g, ok := r.groups[evt.Fingerprint]
+	if !ok {
+		g = &panicGroup{firstSeen: now}
+		r.groups[evt.Fingerprint] = g
+	}
+	g.count++
+	evt.Count = g.count
+	evt.FirstSeen = g.firstSeen
+	if now.Sub(g.lastReport) < r.interval {
+		return false
+	}
+	evt.Suppressed = g.count - g.reported - 1
+	g.reported = g.count
+	g.lastReport = now
+	return true
+}
+
+func (r *recovery) report(evt PanicEvent) {
+	for _, reporter := range r.reporters {
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					Logger.Error("panic上报失败", zap.Any("error", e))
+				}
+			}()
+			reporter.Report(evt)
+		}()
+	}
+}
+
+// handlerPanic 在handler协程中捕获的panic，交给GinRecovery处理时保留panic位置的堆栈与指纹
+type handlerPanic struct {
+	value       interface{}
+	stack       []byte
+	fingerprint string
+}
+
+// newHandlerPanic 需在recover所在的defer函数中直接调用
+func newHandlerPanic(e interface{}) handlerPanic {
+	return handlerPanic{value: e, stack: debug.Stack(), fingerprint: panicFingerprint()}
+}
+
+func (p handlerPanic) String() string {
+	return fmt.Sprintf("%v\n%s", p.value, p.stack)
+}
+
+// panicFingerprint 根据panic位置的调用栈生成指纹，忽略runtime与本文件的栈帧
+func panicFingerprint() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	h := sha1.New()
+	cnt := 0
+	for cnt < 10 {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") && !strings.Contains(frame.Function, "ginlib.(*recovery)") &&
+			!strings.Contains(frame.Function, "ginlib.GinRecoveryWithOptions") {
+			fmt.Fprintf(h, "%s:%d\n", frame.Function, frame.Line)
+			cnt++
+		}
+		if !more {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
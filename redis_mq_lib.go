@@ -1,10 +1,12 @@
 package ginlib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
@@ -14,6 +16,8 @@ type RedisMq struct {
 	queueBackName string        //防丢队列名称
 	hashRepeatCntName string //记录修复次数，修复超过3次，则不在进入防丢队列
 	redisCli      *redis.Client //redis连接客户端
+	stop          chan struct{} //停止修复协程
+	stopOnce      *sync.Once
 }
 
 //NewRedisMq 新建一个redis消息队列
@@ -29,6 +33,8 @@ func NewRedisMq(queueName string, redisCli *redis.Client) RedisMq {
 		queueBackName: fmt.Sprintf("%s_backend_mq_35862714", queueName),
 		hashRepeatCntName: fmt.Sprintf("%s_repeat_mq_35862714", queueName),
 		redisCli:      redisCli,
+		stop:          make(chan struct{}),
+		stopOnce:      &sync.Once{},
 	}
 
 	//每隔一段时间修复消息队列,filterRepeatKey 用于多个进程同时修复时，只有一个进程有修复权限
@@ -42,17 +48,34 @@ func NewRedisMq(queueName string, redisCli *redis.Client) RedisMq {
 		}
 		//定时修复
 		tk := time.NewTicker(d)
-		for _ = range tk.C {
+		defer tk.Stop()
+		for {
+			select {
+			case <-cli.stop:
+				return
+			case <-tk.C:
+			}
 			if redisCli.SetNX(filterRepeatKey, 1, d - time.Second).Val() {
 				Logger.Info("我拿到修复消费队列权限:"+cli.hashRepeatCntName)
 				cli.Repeat()
 			}
 		}
 	}()
+	DefaultLifecycle.OnStop("redis mq "+queueName, StopPriorityConsumer, func(ctx context.Context) error {
+		cli.Close()
+		return nil
+	})
 
 	return cli
 }
 
+//Close 停止消息队列的定时修复
+func (this *RedisMq) Close() {
+	this.stopOnce.Do(func() {
+		close(this.stop)
+	})
+}
+
 //PushMessage 塞入消息
 func (this *RedisMq) PushMessage(msg string) (int64, error) {
 	if msg == "" {
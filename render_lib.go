@@ -0,0 +1,173 @@
+package ginlib
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ctxKeyRenderer  = "ginlib.renderer"
+	ctxKeyErrorCode = "ginlib.error_code"
+)
+
+// RenderResp JsonSucc、JsonFail、JsonError等方法交给渲染器的统一响应信息
+type RenderResp struct {
+	HttpStatus   int         //建议的http状态码，GinJsonRenderer会忽略并始终返回200
+	ErrorCode    int         //业务错误码，0表示成功
+	ErrorMessage string      //错误信息
+	MsgCode      string      //i18n编码
+	Lang         string      //错误信息使用的语言
+	Data         interface{} //返回数据
+	Err          error       //JsonError传入的原始错误，成功时为nil
+}
+
+// ResponseRenderer 响应渲染器，可通过RendererWare按engine或路由组设置
+type ResponseRenderer interface {
+	Render(c *Context, resp RenderResp)
+}
+
+// RenderFunc 使用函数实现ResponseRenderer
+type RenderFunc func(c *Context, resp RenderResp)
+
+func (f RenderFunc) Render(c *Context, resp RenderResp) {
+	f(c, resp)
+}
+
+var (
+	// DefaultRenderer 未设置渲染器时使用的渲染器
+	DefaultRenderer ResponseRenderer = GinJsonRenderer{}
+)
+
+// RendererWare 为engine或路由组设置响应渲染器
+func RendererWare(renderer ResponseRenderer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxKeyRenderer, renderer)
+		c.Next()
+	}
+}
+
+// JsonRender 使用当前请求的渲染器输出响应
+func (c *Context) JsonRender(resp RenderResp) {
+	if resp.HttpStatus == 0 {
+		resp.HttpStatus = http.StatusOK
+		if resp.ErrorCode != 0 {
+			resp.HttpStatus = http.StatusBadRequest
+		}
+	}
+	c.Set(ctxKeyErrorCode, resp.ErrorCode)
+	c.renderer().Render(c, resp)
+}
+
+// ErrorCode 获取当前请求已返回的业务错误码
+func (c *Context) ErrorCode() (code int, exist bool) {
+	if val, ok := c.Get(ctxKeyErrorCode); ok {
+		code, exist = val.(int)
+	}
+	return
+}
+
+func (c *Context) renderer() ResponseRenderer {
+	if val, ok := c.Get(ctxKeyRenderer); ok {
+		if renderer, ok := val.(ResponseRenderer); ok {
+			return renderer
+		}
+	}
+	return DefaultRenderer
+}
+
+// GinJsonRenderer 默认渲染器，输出GinJsonResp结构，http状态码始终为200
+type GinJsonRenderer struct{}
+
+func (GinJsonRenderer) Render(c *Context, resp RenderResp) {
+	c.JSON(http.StatusOK, GinJsonResp{
+		ErrorCode:    resp.ErrorCode,
+		ErrorMessage: resp.ErrorMessage,
+		Data:         resp.Data,
+		MsgCode:      resp.MsgCode,
+		Lang:         resp.Lang,
+	})
+}
+
+// CodeMsgRenderer 输出{code,msg,data}结构
+// HttpStatus 为true时使用真实的http状态码，否则始终为200
+type CodeMsgRenderer struct {
+	HttpStatus bool
+}
+
+func (r CodeMsgRenderer) Render(c *Context, resp RenderResp) {
+	status := http.StatusOK
+	if r.HttpStatus {
+		status = resp.HttpStatus
+	}
+	c.JSON(status, gin.H{
+		"code": resp.ErrorCode,
+		"msg":  resp.ErrorMessage,
+		"data": resp.Data,
+	})
+}
+
+// ProblemRenderer 成功时直接输出data，失败时按RFC 7807输出application/problem+json
+// TypeBase 为problem的type前缀，如https://example.com/errors/，为空时type为about:blank
+type ProblemRenderer struct {
+	TypeBase string
+}
+
+// ProblemResp RFC 7807的problem结构
+type ProblemResp struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     int         `json:"code"`
+	MsgCode  string      `json:"msg_code,omitempty"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+func (r ProblemRenderer) Render(c *Context, resp RenderResp) {
+	if resp.ErrorCode == 0 {
+		c.JSON(resp.HttpStatus, resp.Data)
+		return
+	}
+	problem := ProblemResp{
+		Type:     "about:blank",
+		Title:    http.StatusText(resp.HttpStatus),
+		Status:   resp.HttpStatus,
+		Detail:   resp.ErrorMessage,
+		Instance: c.Request.URL.Path,
+		Code:     resp.ErrorCode,
+		MsgCode:  resp.MsgCode,
+		Errors:   resp.Data,
+	}
+	if r.TypeBase != "" {
+		problem.Type = r.TypeBase + strconv.Itoa(resp.ErrorCode)
+	}
+	if resp.Lang != "" {
+		c.Header("Content-Language", resp.Lang)
+	}
+	c.Render(resp.HttpStatus, problemJSON{problem})
+}
+
+// problemJSON 以application/problem+json输出的json渲染
+type problemJSON struct {
+	Data interface{}
+}
+
+func (r problemJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	raw, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+func (r problemJSON) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	if val := header["Content-Type"]; len(val) == 0 {
+		header["Content-Type"] = []string{"application/problem+json; charset=utf-8"}
+	}
+}
@@ -0,0 +1,123 @@
+package ginlib
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	ctxKeyRequestID = "ginlib.request_id"
+)
+
+type requestMetaKey struct{}
+
+// requestMeta 保存在请求context.Context中的请求信息，用于LoggerFrom
+type requestMeta struct {
+	ID    string
+	Uid   int64
+	Route string
+	IP    string
+}
+
+// RequestIDWare 读取请求头X-Request-ID，没有或不合法时生成新的请求id
+// 请求id保存到gin上下文与请求的context.Context中，并通过响应头X-Request-ID返回
+// 需放在GinLogger、GinRecovery之前使用
+func RequestIDWare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDValid(id) {
+			id = UniqueId()
+		}
+		c.Set(ctxKeyRequestID, id)
+		meta := &requestMeta{ID: id, Route: c.FullPath(), IP: c.ClientIP()}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestMetaKey{}, meta))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestIDValid 请求id最长128位，只允许字母数字与-_.:
+func requestIDValid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID 将请求id放入ctx，用于消息消费、定时任务等非http场景
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestMetaKey{}, &requestMeta{ID: id})
+}
+
+// RequestIDFrom 从ctx中获取请求id，没有时返回空
+func RequestIDFrom(ctx context.Context) string {
+	if meta := requestMetaFrom(ctx); meta != nil {
+		return meta.ID
+	}
+	return ""
+}
+
+func requestMetaFrom(ctx context.Context) *requestMeta {
+	if ctx == nil {
+		return nil
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return nil
+		}
+		ctx = c.Request.Context()
+	}
+	meta, _ := ctx.Value(requestMetaKey{}).(*requestMeta)
+	return meta
+}
+
+// requestMetaSetUid 登录认证通过后记录uid
+func requestMetaSetUid(c *gin.Context, uid int64) {
+	if meta := requestMetaFrom(c.Request.Context()); meta != nil {
+		meta.Uid = uid
+	}
+}
+
+// LoggerFrom 返回附加了ctx中请求id、uid、路由与客户端ip的Logger，ctx中没有请求信息时返回Logger
+func LoggerFrom(ctx context.Context) *zap.Logger {
+	meta := requestMetaFrom(ctx)
+	if meta == nil {
+		return Logger
+	}
+	return Logger.With(requestLogFields(meta.ID, meta.Uid, meta.Route, meta.IP)...)
+}
+
+// RequestID 获取当前请求id
+func (c *Context) RequestID() string {
+	return c.GetString(ctxKeyRequestID)
+}
+
+// Log 返回附加了请求id、uid、路由与客户端ip的Logger
+func (c *Context) Log() *zap.Logger {
+	return Logger.With(requestLogFields(c.RequestID(), c.GetInt64("uid"), c.FullPath(), c.ClientIP())...)
+}
+
+func requestLogFields(id string, uid int64, route, ip string) []zap.Field {
+	fields := make([]zap.Field, 0, 4)
+	if id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if uid > 0 {
+		fields = append(fields, zap.Int64("uid", uid))
+	}
+	if route != "" {
+		fields = append(fields, zap.String("route", route))
+	}
+	if ip != "" {
+		fields = append(fields, zap.String("ip", ip))
+	}
+	return fields
+}
@@ -0,0 +1,522 @@
+package ginlib
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ctxKeyResponseCache     = "ginlib.response_cache"
+	ctxKeyResponseCacheTags = "ginlib.response_cache_tags"
+
+	ResponseCacheHeader = "X-Cache" //HIT或MISS
+)
+
+var (
+	//metricResponseCache 响应缓存命中情况，result为hit、miss，<namespace>_response_cache_requests_total
+	metricResponseCache = newMetricLazy(func(namespace string) prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "response_cache_requests_total",
+		}, []string{"route", "result"})
+	})
+)
+
+// ResponseCacheRule 响应缓存规则，只缓存GET、HEAD请求
+type ResponseCacheRule struct {
+	Route string        //路由模板，如/product/:id，以*结尾时按前缀匹配
+	TTL   time.Duration //缓存时间
+	Uid   bool          //为true时按AuthWare设置的uid分别缓存，没有uid的请求不使用缓存
+	Tags  []string      //缓存标签，可通过InvalidateTags使缓存失效，handler中可通过c.CacheTags追加
+}
+
+// CachedResponse 缓存的响应
+type CachedResponse struct {
+	Status      int      `json:"status"`
+	ContentType string   `json:"content_type"`
+	Body        []byte   `json:"body"`
+	ETag        string   `json:"etag"`
+	Tags        []string `json:"tags"`
+	Versions    []int64  `json:"versions"`             //缓存时各标签的版本，与当前版本不一致时缓存失效
+	ErrorCode   *int     `json:"error_code,omitempty"` //JsonRender返回的业务错误码，命中缓存时恢复，供请求指标与日志使用
+}
+
+// ResponseCacheStore 响应缓存存储
+type ResponseCacheStore interface {
+	// Get 获取缓存，不存在时返回nil
+	Get(key string) (*CachedResponse, error)
+	Set(key string, resp *CachedResponse, ttl time.Duration) error
+	// TagVersions 获取标签的当前版本
+	TagVersions(tags []string) ([]int64, error)
+	// InvalidateTags 增加标签版本，使带有这些标签的缓存失效
+	InvalidateTags(tags ...string) error
+}
+
+// ResponseCache 响应缓存
+type ResponseCache struct {
+	store ResponseCacheStore
+	rules []ResponseCacheRule
+}
+
+type ResponseCacheOption func(r *ResponseCache)
+
+// WithResponseCacheRules 设置缓存规则，按顺序匹配第一条
+func WithResponseCacheRules(rules ...ResponseCacheRule) ResponseCacheOption {
+	return func(r *ResponseCache) {
+		r.rules = append(r.rules, rules...)
+	}
+}
+
+// NewResponseCache 创建响应缓存，store为nil时使用进程内存储
+func NewResponseCache(store ResponseCacheStore, opts ...ResponseCacheOption) *ResponseCache {
+	if store == nil {
+		store = NewMemoryResponseCacheStore()
+	}
+	r := &ResponseCache{store: store}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// InvalidateTags 使带有这些标签的缓存失效
+func (r *ResponseCache) InvalidateTags(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return r.store.InvalidateTags(tags...)
+}
+
+// Ware 响应缓存中间件，按请求路径、query、语言以及可选的uid缓存，响应带Vary头
+// 只缓存http状态码为200且JsonRender错误码为0的响应，缓存的是完整的响应体，GinJsonResp等结构保持不变
+// 标签版本在handler执行前读取，handler执行期间标签失效时缓存的响应随即失效
+// 响应带ETag，请求的If-None-Match一致时返回304，存储出错时不使用缓存
+// 规则设置Uid时需放在AuthWare之后，否则获取不到uid，请求不会使用缓存
+func (r *ResponseCache) Ware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ctxKeyResponseCache, r)
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		route := c.FullPath()
+		rule, ok := r.match(route)
+		if !ok || (rule.Uid && c.GetInt64("uid") <= 0) {
+			c.Next()
+			return
+		}
+		this := Context{c}
+		key := r.key(&this, rule)
+		//缓存内容随语言与用户变化
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		if rule.Uid {
+			c.Writer.Header().Add("Vary", "Cookie")
+			c.Writer.Header().Add("Vary", "Authorization")
+		}
+
+		cached, err := r.get(key)
+		if err != nil {
+			this.Log().Warn("响应缓存读取失败", zap.String("key", key), zap.Error(err))
+		}
+		if cached != nil {
+			metricResponseCache.counter().WithLabelValues(route, "hit").Inc()
+			c.Header(ResponseCacheHeader, "HIT")
+			if cached.ErrorCode != nil {
+				c.Set(ctxKeyErrorCode, *cached.ErrorCode)
+			}
+			responseCacheServe(c, cached)
+			c.Abort()
+			return
+		}
+		metricResponseCache.counter().WithLabelValues(route, "miss").Inc()
+
+		//在读取数据前记录标签版本，handler执行期间的失效会使本次缓存的响应失效
+		tags := &responseCacheTags{}
+		if err == nil {
+			err = tags.add(r.store, rule.Tags)
+		}
+		c.Set(ctxKeyResponseCacheTags, tags)
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		defer func() {
+			//panic时丢弃已缓存的内容，由GinRecovery输出错误
+			if c.Writer == writer {
+				c.Writer = writer.ResponseWriter
+			}
+		}()
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		if writer.passthrough {
+			return
+		}
+		code, hasCode := this.ErrorCode()
+		if writer.status != http.StatusOK || (hasCode && code != 0) || err != nil || tags.err != nil {
+			writer.flush()
+			return
+		}
+
+		body := writer.body.Bytes()
+		sum := sha1.Sum(body)
+		resp := &CachedResponse{
+			Status:      writer.status,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        body,
+			ETag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+			Tags:        tags.tags,
+			Versions:    tags.versions,
+		}
+		if hasCode {
+			resp.ErrorCode = &code
+		}
+		if err = r.store.Set(key, resp, rule.TTL); err != nil {
+			this.Log().Warn("响应缓存保存失败", zap.String("key", key), zap.Error(err))
+		}
+		c.Header(ResponseCacheHeader, "MISS")
+		responseCacheServe(c, resp)
+	}
+}
+
+func (r *ResponseCache) match(route string) (ResponseCacheRule, bool) {
+	if route == "" {
+		return ResponseCacheRule{}, false
+	}
+	for _, rule := range r.rules {
+		if rule.TTL <= 0 {
+			continue
+		}
+		if rule.Route == route || (strings.HasSuffix(rule.Route, "*") && strings.HasPrefix(route, strings.TrimSuffix(rule.Route, "*"))) {
+			return rule, true
+		}
+	}
+	return ResponseCacheRule{}, false
+}
+
+// key 请求路径与排序后的query、语言以及uid，sha1后作为缓存key
+func (r *ResponseCache) key(c *Context, rule ResponseCacheRule) string {
+	raw := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode() + "|" + Lang(c.Request.Context())
+	if rule.Uid {
+		raw += "|" + strconv.FormatInt(c.GetInt64("uid"), 10)
+	}
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// get 获取缓存，标签版本已变化的缓存视为不存在
+func (r *ResponseCache) get(key string) (*CachedResponse, error) {
+	resp, err := r.store.Get(key)
+	if err != nil || resp == nil || len(resp.Tags) == 0 {
+		return resp, err
+	}
+	versions, err := r.store.TagVersions(resp.Tags)
+	if err != nil {
+		return nil, err
+	}
+	for i, val := range versions {
+		if i >= len(resp.Versions) || resp.Versions[i] != val {
+			return nil, nil
+		}
+	}
+	return resp, nil
+}
+
+// responseCacheTags 当前响应的标签以及添加标签时读取的版本
+type responseCacheTags struct {
+	tags     []string
+	versions []int64
+	err      error
+}
+
+func (t *responseCacheTags) add(store ResponseCacheStore, tags []string) error {
+	if len(tags) == 0 || t.err != nil {
+		return t.err
+	}
+	versions, err := store.TagVersions(tags)
+	if err != nil {
+		t.err = err
+		return err
+	}
+	t.tags = append(t.tags, tags...)
+	t.versions = append(t.versions, versions...)
+	return nil
+}
+
+// responseCacheServe 输出缓存的响应，If-None-Match一致时返回304
+func responseCacheServe(c *gin.Context, resp *CachedResponse) {
+	c.Header("ETag", resp.ETag)
+	if responseCacheETagMatch(c.GetHeader("If-None-Match"), resp.ETag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	if resp.ContentType != "" {
+		c.Header("Content-Type", resp.ContentType)
+	}
+	c.Status(resp.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Writer.Write(resp.Body)
+}
+
+func responseCacheETagMatch(header, etag string) bool {
+	for _, val := range strings.Split(header, ",") {
+		val = strings.TrimPrefix(strings.TrimSpace(val), "W/")
+		if val == "*" || val == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheTags 为当前响应追加缓存标签，如"product:1"，需在读取数据前调用
+// 调用时读取标签版本，之后标签失效时缓存的响应随即失效
+func (c *Context) CacheTags(tags ...string) {
+	val, ok := c.Get(ctxKeyResponseCacheTags)
+	if !ok {
+		return
+	}
+	r, ok := c.Get(ctxKeyResponseCache)
+	if !ok {
+		return
+	}
+	if err := val.(*responseCacheTags).add(r.(*ResponseCache).store, tags); err != nil {
+		c.Log().Warn("响应缓存标签版本读取失败", zap.Strings("tags", tags), zap.Error(err))
+	}
+}
+
+// CacheInvalidate 使带有这些标签的缓存失效，需已使用ResponseCache.Ware
+func (c *Context) CacheInvalidate(tags ...string) error {
+	if val, ok := c.Get(ctxKeyResponseCache); ok {
+		if r, ok := val.(*ResponseCache); ok {
+			return r.InvalidateTags(tags...)
+		}
+	}
+	return nil
+}
+
+// bufferedWriter 缓存响应头与响应体，调用Flush时改为直接输出
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status      int
+	written     bool
+	body        bytes.Buffer
+	passthrough bool
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	w.written = true
+	return w.body.Write(p)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.written
+}
+
+func (w *bufferedWriter) Flush() {
+	w.flush()
+	w.ResponseWriter.Flush()
+}
+
+// flush 输出已缓存的内容，之后直接输出
+func (w *bufferedWriter) flush() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	} else if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// memoryResponseCacheStore 进程内的响应缓存，只适用于单实例部署
+type memoryResponseCacheStore struct {
+	lock      sync.RWMutex
+	items     map[string]*memoryResponseCacheItem
+	tags      map[string]int64
+	lastClean time.Time
+}
+
+type memoryResponseCacheItem struct {
+	resp   *CachedResponse
+	expire time.Time
+}
+
+// NewMemoryResponseCacheStore 创建进程内的响应缓存
+func NewMemoryResponseCacheStore() ResponseCacheStore {
+	return &memoryResponseCacheStore{
+		items:     make(map[string]*memoryResponseCacheItem),
+		tags:      make(map[string]int64),
+		lastClean: time.Now(),
+	}
+}
+
+func (m *memoryResponseCacheStore) Get(key string) (*CachedResponse, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if item, ok := m.items[key]; ok && time.Now().Before(item.expire) {
+		return item.resp, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryResponseCacheStore) Set(key string, resp *CachedResponse, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	//定期清理过期的缓存
+	if now.Sub(m.lastClean) > time.Minute {
+		for k, val := range m.items {
+			if now.After(val.expire) {
+				delete(m.items, k)
+			}
+		}
+		m.lastClean = now
+	}
+	m.items[key] = &memoryResponseCacheItem{resp: resp, expire: now.Add(ttl)}
+	return nil
+}
+
+func (m *memoryResponseCacheStore) TagVersions(tags []string) ([]int64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	versions := make([]int64, len(tags))
+	for i, tag := range tags {
+		versions[i] = m.tags[tag]
+	}
+	return versions, nil
+}
+
+func (m *memoryResponseCacheStore) InvalidateTags(tags ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, tag := range tags {
+		m.tags[tag]++
+	}
+	return nil
+}
+
+// redisResponseCacheStore 基于redis的响应缓存，适用于多实例部署
+type redisResponseCacheStore struct {
+	redisCli *redis.Client
+	prefix   string
+}
+
+// NewRedisResponseCacheStore 创建基于redis的响应缓存
+func NewRedisResponseCacheStore(redisCli *redis.Client) ResponseCacheStore {
+	return &redisResponseCacheStore{redisCli: redisCli, prefix: "resp_cache:"}
+}
+
+func (r *redisResponseCacheStore) Get(key string) (*CachedResponse, error) {
+	data, err := r.redisCli.Get(r.prefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	resp := &CachedResponse{}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *redisResponseCacheStore) Set(key string, resp *CachedResponse, ttl time.Duration) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return r.redisCli.Set(r.prefix+key, data, ttl).Err()
+}
+
+func (r *redisResponseCacheStore) TagVersions(tags []string) ([]int64, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = r.prefix + "tag:" + tag
+	}
+	vals, err := r.redisCli.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, len(tags))
+	for i, val := range vals {
+		if s, ok := val.(string); ok {
+			versions[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return versions, nil
+}
+
+func (r *redisResponseCacheStore) InvalidateTags(tags ...string) error {
+	_, err := r.redisCli.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			pipe.Incr(r.prefix + "tag:" + tag)
+		}
+		return nil
+	})
+	return err
+}
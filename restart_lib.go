@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package ginlib
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	envInheritFds = "GINLIB_INHERIT_FDS" //子进程继承的监听数量，监听的fd从3开始
+	envReadyFd    = "GINLIB_READY_FD"    //子进程就绪后写入的管道fd
+)
+
+// inheritListeners 从父进程继承监听，非平滑重启启动的进程返回nil
+func inheritListeners(n int) ([]net.Listener, error) {
+	val := os.Getenv(envInheritFds)
+	if val == "" {
+		return nil, nil
+	}
+	_ = os.Unsetenv(envInheritFds)
+	cnt, err := strconv.Atoi(val)
+	if err != nil || cnt != n {
+		return nil, fmt.Errorf("继承的监听数量%s与配置的监听数量%d不一致", val, n)
+	}
+	listeners := make([]net.Listener, 0, cnt)
+	for i := 0; i < cnt; i++ {
+		f := os.NewFile(uintptr(3+i), "listener"+strconv.Itoa(i))
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("继承监听失败:%w", err)
+		}
+		listeners = append(listeners, ln)
+	}
+	log.Println("从父进程继承监听成功, count:", cnt)
+	return listeners, nil
+}
+
+// restartReady 通知父进程子进程已就绪
+func restartReady() {
+	val := os.Getenv(envReadyFd)
+	if val == "" {
+		return
+	}
+	_ = os.Unsetenv(envReadyFd)
+	fd, err := strconv.Atoi(val)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	_, _ = f.Write([]byte{1})
+	_ = f.Close()
+}
+
+// restartWatch 注册重启信号，收到SIGHUP或SIGUSR2后启动继承监听的子进程，子进程就绪后停止当前进程
+// SIGHUP已用于日志切割时只响应SIGUSR2，避免切割日志时触发重启
+func restartWatch(l *Lifecycle, listeners []net.Listener, readyTimeout time.Duration) {
+	sigs := []os.Signal{syscall.SIGUSR2}
+	if syscall.Signal(atomic.LoadInt32(&logRotateSig)) == syscall.SIGHUP {
+		log.Println("SIGHUP已用于日志切割，平滑重启只响应SIGUSR2")
+	} else {
+		sigs = append(sigs, syscall.SIGHUP)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		for sig := range ch {
+			log.Println("got a restart signal", sig)
+			pid, err := restartChild(listeners, readyTimeout)
+			if err != nil {
+				log.Println("平滑重启失败:", err.Error())
+				continue
+			}
+			log.Println("平滑重启子进程已就绪, pid:", pid)
+			signal.Stop(ch)
+			l.setRestarting()
+			l.Stop()
+			return
+		}
+	}()
+}
+
+// restartChild 启动子进程并传递监听，等待子进程就绪
+func restartChild(listeners []net.Listener, readyTimeout time.Duration) (pid int, err error) {
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, ln := range listeners {
+		var f *os.File
+		switch v := ln.(type) {
+		case *net.TCPListener:
+			f, err = v.File()
+		case *net.UnixListener:
+			//当前进程关闭监听时不删除socket文件，子进程继续使用
+			v.SetUnlinkOnClose(false)
+			f, err = v.File()
+		default:
+			err = fmt.Errorf("不支持继承的监听类型:%T", ln)
+		}
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		_ = w.Close()
+		return 0, err
+	}
+	env := make([]string, 0)
+	for _, val := range os.Environ() {
+		if !strings.HasPrefix(val, envInheritFds+"=") && !strings.HasPrefix(val, envReadyFd+"=") {
+			env = append(env, val)
+		}
+	}
+	env = append(env, fmt.Sprintf("%s=%d", envInheritFds, len(files)), fmt.Sprintf("%s=%d", envReadyFd, 3+len(files)))
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = append(files, w)
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	readyCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, e := r.Read(buf)
+		readyCh <- e
+	}()
+	select {
+	case err = <-readyCh:
+		if err == nil {
+			return cmd.Process.Pid, nil
+		}
+		err = fmt.Errorf("子进程未就绪即退出:%w", err)
+	case <-time.After(readyTimeout):
+		err = fmt.Errorf("等待子进程就绪超时")
+	}
+	_ = cmd.Process.Kill()
+	go cmd.Wait()
+	return 0, err
+}
@@ -0,0 +1,18 @@
+package ginlib
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// inheritListeners windows不支持平滑重启
+func inheritListeners(n int) ([]net.Listener, error) {
+	return nil, nil
+}
+
+func restartReady() {}
+
+func restartWatch(l *Lifecycle, listeners []net.Listener, readyTimeout time.Duration) {
+	log.Println("windows不支持平滑重启")
+}
@@ -0,0 +1,106 @@
+package ginlib
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ctxKeyCspNonce = "ginlib.csp_nonce"
+)
+
+// SecureHeadersConfig 安全响应头配置，字段为空时不设置对应的响应头
+type SecureHeadersConfig struct {
+	HSTSMaxAge            time.Duration //Strict-Transport-Security的max-age，只对https请求设置
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	FrameOptions          string //X-Frame-Options，如DENY、SAMEORIGIN
+	ContentTypeNosniff    bool   //X-Content-Type-Options: nosniff
+	ReferrerPolicy        string //Referrer-Policy，如strict-origin-when-cross-origin
+	CSP                   string //Content-Security-Policy，{nonce}替换为每个请求的随机数，如script-src 'self' 'nonce-{nonce}'
+	CSPReportOnly         bool   //为true时使用Content-Security-Policy-Report-Only
+}
+
+// SecureHeadersConfigFromIni 从ini的section中读取安全响应头配置
+// hsts_max_age=8760h hsts_include_subdomains=true hsts_preload=false frame_options=DENY
+// content_type_nosniff=true referrer_policy=strict-origin-when-cross-origin csp=... csp_report_only=false
+func SecureHeadersConfigFromIni(section string) SecureHeadersConfig {
+	conf := SecureHeadersConfig{
+		HSTSIncludeSubdomains: Ini_Bool(section + ".hsts_include_subdomains"),
+		HSTSPreload:           Ini_Bool(section + ".hsts_preload"),
+		FrameOptions:          Ini_Str(section+".frame_options", "DENY"),
+		ContentTypeNosniff:    Ini_Bool(section+".content_type_nosniff", true),
+		ReferrerPolicy:        Ini_Str(section+".referrer_policy", "strict-origin-when-cross-origin"),
+		CSP:                   Ini_Str(section + ".csp"),
+		CSPReportOnly:         Ini_Bool(section + ".csp_report_only"),
+	}
+	if val := Ini_Str(section + ".hsts_max_age"); val != "" {
+		conf.HSTSMaxAge, _ = time.ParseDuration(val)
+	}
+	return conf
+}
+
+// SecureHeadersWare 设置安全响应头，CSP中使用{nonce}时为每个请求生成随机数，页面通过c.CspNonce()获取
+func SecureHeadersWare(conf SecureHeadersConfig) gin.HandlerFunc {
+	hsts := ""
+	if conf.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(conf.HSTSMaxAge.Seconds()))
+		if conf.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if conf.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	cspHeader := "Content-Security-Policy"
+	if conf.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(conf.CSP, "{nonce}")
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if hsts != "" && (c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		if conf.FrameOptions != "" {
+			header.Set("X-Frame-Options", conf.FrameOptions)
+		}
+		if conf.ContentTypeNosniff {
+			header.Set("X-Content-Type-Options", "nosniff")
+		}
+		if conf.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", conf.ReferrerPolicy)
+		}
+		if conf.CSP != "" {
+			csp := conf.CSP
+			if useNonce {
+				buf := make([]byte, 16)
+				if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+					//不能使用可预测的nonce，否则CSP的nonce限制失效
+					this := Context{c}
+					this.Log().Error("生成CSP nonce失败", zap.Error(err))
+					this.JsonError(ErrSystem.New())
+					c.Abort()
+					return
+				}
+				nonce := base64.StdEncoding.EncodeToString(buf)
+				c.Set(ctxKeyCspNonce, nonce)
+				csp = strings.Replace(csp, "{nonce}", nonce, -1)
+			}
+			header.Set(cspHeader, csp)
+		}
+		c.Next()
+	}
+}
+
+// CspNonce 当前请求CSP的随机数，用于页面中<script nonce="...">
+func (c *Context) CspNonce() string {
+	return c.GetString(ctxKeyCspNonce)
+}
@@ -0,0 +1,254 @@
+package ginlib
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ListenerConfig web服务的监听配置
+type ListenerConfig struct {
+	Name     string       //监听名称，用于日志
+	Network  string       //tcp或unix，默认tcp
+	Addr     string       //tcp时为host:port，unix时为socket文件路径
+	CertFile string       //证书文件，与KeyFile同时配置时使用https，文件变化后自动重新加载
+	KeyFile  string       //证书私钥文件
+	H2C      bool         //是否支持明文http/2
+	Handler  http.Handler //该监听使用的handler，为空时使用engine
+}
+
+type webServer struct {
+	listeners    []ListenerConfig
+	serverConfig func(srv *http.Server)
+	lifecycle    *Lifecycle
+	restart      bool
+	readyTimeout time.Duration
+}
+
+type ServerOption func(s *webServer)
+
+// WithListener 增加一个监听，可多次使用，如对外端口与内部管理端口
+func WithListener(l ListenerConfig) ServerOption {
+	return func(s *webServer) {
+		s.listeners = append(s.listeners, l)
+	}
+}
+
+// WithServerConfig 自定义http.Server的参数，如读写超时
+func WithServerConfig(fn func(srv *http.Server)) ServerOption {
+	return func(s *webServer) {
+		s.serverConfig = fn
+	}
+}
+
+// WithLifecycle 设置使用的生命周期管理器，默认DefaultLifecycle
+func WithLifecycle(l *Lifecycle) ServerOption {
+	return func(s *webServer) {
+		s.lifecycle = l
+	}
+}
+
+// WithGracefulRestart 开启平滑重启(不支持windows)
+// 收到SIGHUP或SIGUSR2后使用相同的启动参数启动新进程，新进程继承所有监听，InitLogger使用SIGHUP切割日志时只响应SIGUSR2
+// 新进程在readyTimeout内就绪后当前进程停止接收新连接，处理完进行中的请求后退出；新进程启动失败时当前进程继续服务
+// readyTimeout 等待新进程就绪的时间，不传时默认30秒
+func WithGracefulRestart(readyTimeout ...time.Duration) ServerOption {
+	return func(s *webServer) {
+		s.restart = true
+		s.readyTimeout = 30 * time.Second
+		if len(readyTimeout) > 0 {
+			s.readyTimeout = readyTimeout[0]
+		}
+	}
+}
+
+// ServeWeb 启动web服务并阻塞等待退出信号，支持多监听、https、h2c与unix socket
+// 开始服务前执行生命周期管理器的启动钩子，所有监听都注册到生命周期管理器中，收到退出信号后统一优雅停止
+func ServeWeb(engine *gin.Engine, opts ...ServerOption) error {
+	s := &webServer{lifecycle: DefaultLifecycle}
+	for _, o := range opts {
+		o(s)
+	}
+	if len(s.listeners) == 0 {
+		return fmt.Errorf("请至少配置一个监听")
+	}
+	var inherited []net.Listener
+	if s.restart {
+		var err error
+		if inherited, err = inheritListeners(len(s.listeners)); err != nil {
+			return err
+		}
+	}
+	servers := make([]*http.Server, 0, len(s.listeners))
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for idx, conf := range s.listeners {
+		var ln net.Listener
+		srv, err := s.newServer(engine, conf)
+		if err == nil {
+			if inherited != nil {
+				ln = inherited[idx]
+			} else {
+				ln, err = listen(conf)
+			}
+		}
+		if err != nil {
+			for _, val := range append(listeners, inherited...) {
+				_ = val.Close()
+			}
+			return fmt.Errorf("监听%s失败:%w", listenerName(conf), err)
+		}
+		servers = append(servers, srv)
+		listeners = append(listeners, ln)
+	}
+	//执行启动钩子，失败时不开始服务，平滑重启时父进程继续服务
+	if err := s.lifecycle.Start(context.Background()); err != nil {
+		for _, val := range listeners {
+			_ = val.Close()
+		}
+		return err
+	}
+	if s.restart {
+		//开始服务前注册重启信号，避免信号到达时进程被默认行为终止
+		restartWatch(s.lifecycle, listeners, s.readyTimeout)
+	}
+	for idx, srv := range servers {
+		conf, ln := s.listeners[idx], listeners[idx]
+		go serve(srv, ln, conf)
+		s.lifecycle.OnStop("http server "+listenerName(conf), StopPriorityServer, srv.Shutdown)
+	}
+	if s.restart {
+		//通知父进程已就绪，父进程随后退出
+		restartReady()
+	}
+
+	s.lifecycle.Wait()
+	return nil
+}
+
+// newServer 根据监听配置创建http.Server
+func (s *webServer) newServer(engine *gin.Engine, conf ListenerConfig) (*http.Server, error) {
+	handler := conf.Handler
+	if handler == nil {
+		handler = engine
+	}
+	srv := &http.Server{Addr: conf.Addr}
+	if s.serverConfig != nil {
+		s.serverConfig(srv)
+	}
+	if conf.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	srv.Handler = handler
+	if conf.CertFile != "" && conf.KeyFile != "" {
+		reloader, err := newCertReloader(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if srv.TLSConfig == nil {
+			srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		srv.TLSConfig.GetCertificate = reloader.GetCertificate
+	}
+	return srv, nil
+}
+
+// listen 创建监听，unix socket会先删除残留的socket文件，路径为普通文件时不删除
+func listen(conf ListenerConfig) (net.Listener, error) {
+	network := conf.Network
+	if network == "" {
+		network = "tcp"
+	}
+	if network == "unix" {
+		if info, err := os.Stat(conf.Addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(conf.Addr)
+		}
+	}
+	return net.Listen(network, conf.Addr)
+}
+
+func serve(srv *http.Server, ln net.Listener, conf ListenerConfig) {
+	log.Println("web服务启动, listen:" + listenerName(conf))
+	var err error
+	if srv.TLSConfig != nil && srv.TLSConfig.GetCertificate != nil {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Println("server listen failed! error:", err.Error())
+	}
+}
+
+func listenerName(conf ListenerConfig) string {
+	if conf.Name != "" {
+		return conf.Name + "(" + conf.Addr + ")"
+	}
+	return conf.Addr
+}
+
+// certReloader 证书文件变化后自动重新加载，无需重启服务
+type certReloader struct {
+	certFile  string
+	keyFile   string
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.cert = &cert
+	r.modTime = info.ModTime()
+	r.lock.Unlock()
+	return nil
+}
+
+// GetCertificate 每10秒最多检查一次证书文件的修改时间
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	cert, modTime, checkTime := r.cert, r.modTime, r.checkTime
+	r.lock.RUnlock()
+	if time.Since(checkTime) < 10*time.Second {
+		return cert, nil
+	}
+	r.lock.Lock()
+	r.checkTime = time.Now()
+	r.lock.Unlock()
+	if info, err := os.Stat(r.certFile); err == nil && info.ModTime().After(modTime) {
+		if err = r.reload(); err != nil {
+			log.Println("重新加载证书失败:", err.Error())
+		} else {
+			log.Println("重新加载证书成功:", r.certFile)
+		}
+		r.lock.RLock()
+		cert = r.cert
+		r.lock.RUnlock()
+	}
+	return cert, nil
+}
@@ -0,0 +1,271 @@
+package ginlib
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrObjectNotFound 对象不存在
+	ErrObjectNotFound = errors.New("object not found")
+
+	// DefaultStorage 默认的对象存储，InitStorage或InitTxCloud后设置，SaveUpload未指定存储时使用
+	DefaultStorage Storage
+)
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ETag        string    `json:"etag"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// PutOptions 上传对象的参数
+type PutOptions struct {
+	ContentType string
+	Size        int64 //内容长度，未知时传-1，cos需读入内存后上传
+}
+
+// Storage 对象存储
+type Storage interface {
+	// Put 上传对象，对象已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get 读取对象，调用方需关闭返回的ReadCloser，对象不存在时返回ErrObjectNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// Stat 获取对象信息，对象不存在时返回ErrObjectNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Presign 生成有效期为expire的临时访问地址，method为GET或PUT
+	Presign(ctx context.Context, key string, method string, expire time.Duration) (string, error)
+	// List 按key字典序列出前缀为prefix的对象，marker为上一页返回的nextMarker，nextMarker为空时表示没有更多
+	List(ctx context.Context, prefix, marker string, limit int) (items []ObjectInfo, nextMarker string, err error)
+}
+
+// InitStorage 根据ini配置初始化DefaultStorage
+// [storage]
+// driver=local 或 cos，默认cos，cos读取[tx]中的配置
+// local_root=./uploads 本地存储根目录
+// local_url=http://127.0.0.1:8080/files 本地存储的访问地址，需将LocalStorage.Handler注册到该地址
+// local_secret= 本地存储临时访问地址的签名密钥
+func InitStorage() {
+	if Ini_Str("storage.driver", "cos") == "local" {
+		DefaultStorage = NewLocalStorage(Ini_Str("storage.local_root", "./uploads"), Ini_Str("storage.local_url"), Ini_Str("storage.local_secret"))
+		return
+	}
+	InitTxCloud()
+}
+
+// LocalStorage 本地文件系统存储，适用于开发环境或单机部署
+type LocalStorage struct {
+	root    string
+	baseURL string
+	secret  string
+}
+
+// NewLocalStorage 创建本地文件系统存储
+// baseURL 访问地址前缀，临时访问地址为baseURL/key?expires=xx&sign=xx，需将Handler注册到该地址
+// secret 临时访问地址的签名密钥
+func NewLocalStorage(root, baseURL, secret string) *LocalStorage {
+	return &LocalStorage{root: root, baseURL: strings.TrimRight(baseURL, "/"), secret: secret}
+}
+
+// path 将key转换为文件路径，不允许访问根目录之外的文件
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("非法的对象key:%s", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	//先写入临时文件再重命名，避免读取到写了一半的文件
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrObjectNotFound
+	} else if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.objectInfo(key, info), nil
+}
+
+func (s *LocalStorage) objectInfo(key string, info os.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ETag:        fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		ModTime:     info.ModTime(),
+	}
+}
+
+func (s *LocalStorage) Presign(ctx context.Context, key string, method string, expire time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	query := url.Values{"expires": {expires}, "sign": {s.sign(method, key, expires)}}
+	return s.baseURL + "/" + strings.TrimLeft(key, "/") + "?" + query.Encode(), nil
+}
+
+func (s *LocalStorage) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(strings.ToUpper(method) + "\n" + strings.TrimLeft(key, "/") + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix, marker string, limit int) (items []ObjectInfo, nextMarker string, err error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	//从前缀所在的目录开始遍历，filepath.Walk按字典序遍历
+	dir := s.root
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		dir = filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+prefix[:idx])))
+	}
+	keys := make([]string, 0)
+	infos := make(map[string]os.FileInfo)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+			infos[key] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+		nextMarker = keys[limit-1]
+	}
+	for _, key := range keys {
+		items = append(items, s.objectInfo(key, infos[key]))
+	}
+	return items, nextMarker, nil
+}
+
+// Handler 处理Presign生成的临时访问地址，支持GET下载与PUT上传，路由需以*key结尾
+// r.GET("/files/*key", store.Handler())
+// r.PUT("/files/*key", store.Handler())
+func (s *LocalStorage) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimLeft(c.Param("key"), "/")
+		expires := c.Query("expires")
+		ts, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || time.Now().Unix() > ts || s.secret == "" ||
+			!hmac.Equal([]byte(c.Query("sign")), []byte(s.sign(c.Request.Method, key, expires))) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodPut:
+			if err = s.Put(c.Request.Context(), key, c.Request.Body, PutOptions{ContentType: c.ContentType(), Size: c.Request.ContentLength}); err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			c.Status(http.StatusOK)
+		case http.MethodGet, http.MethodHead:
+			p, err := s.path(key)
+			if err != nil {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			if info, err := os.Stat(p); err != nil || info.IsDir() {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.File(p)
+		default:
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package ginlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ctxKeyStream = "ginlib.stream"
+
+	StreamKindSSE       = "sse"
+	StreamKindJsonLines = "jsonl"
+
+	streamCloseFinish     = "finish"     //调用Close结束
+	streamCloseServer     = "server"     //handler返回时未调用Close
+	streamCloseDisconnect = "disconnect" //客户端断开
+)
+
+var (
+	// ErrStreamClosed 流已关闭或客户端已断开
+	ErrStreamClosed = errors.New("stream closed")
+
+	streamMetricsOnce sync.Once
+	streamMetrics     *streamMetricSet
+)
+
+// streamMetricSet 流式响应指标，以APP_NAME为前缀
+// <namespace>_http_stream_connections 当前流式连接数
+// <namespace>_http_stream_events_total 流式推送的消息数
+// <namespace>_http_stream_duration_seconds 流式连接持续时间(秒)
+type streamMetricSet struct {
+	connections *prometheus.GaugeVec
+	events      *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+// streamMetricsGet 首次使用时创建指标，此时需已调用InitIni
+func streamMetricsGet() *streamMetricSet {
+	streamMetricsOnce.Do(func() {
+		namespace := metricNamespace("")
+		reg := prometheus.DefaultRegisterer
+		streamMetrics = &streamMetricSet{
+			connections: metricRegister(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "http_stream_connections",
+			}, []string{"path", "kind"})).(*prometheus.GaugeVec),
+			events: metricRegister(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "http_stream_events_total",
+			}, []string{"path", "kind"})).(*prometheus.CounterVec),
+			duration: metricRegister(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "http_stream_duration_seconds",
+				Buckets:   []float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600},
+			}, []string{"path", "kind", "reason"})).(*prometheus.HistogramVec),
+		}
+	})
+	return streamMetrics
+}
+
+// StreamStat 流式响应的统计，GinLogger与MiddleRequestMetric据此区分流式请求
+type StreamStat struct {
+	Kind         string
+	Events       int
+	Bytes        int
+	Disconnected bool //是否因客户端断开而结束
+}
+
+// streamStatOf 获取请求的流式响应统计，非流式请求返回nil
+func streamStatOf(c *gin.Context) *StreamStat {
+	if val, ok := c.Get(ctxKeyStream); ok {
+		if stat, ok := val.(*StreamStat); ok {
+			return stat
+		}
+	}
+	return nil
+}
+
+// stream SSE与JSON lines共用的写入逻辑，并发安全
+type stream struct {
+	c       *Context
+	flusher http.Flusher
+	metrics *streamMetricSet
+	path    string
+	start   time.Time
+	lock    sync.Mutex
+	stat    *StreamStat
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newStream(c *Context, kind string, contentType string) *stream {
+	s := &stream{
+		c:       c,
+		metrics: streamMetricsGet(),
+		path:    c.FullPath(),
+		start:   time.Now(),
+		stat:    &StreamStat{Kind: kind},
+		done:    make(chan struct{}),
+	}
+	if s.path == "" {
+		s.path = c.Request.URL.Path
+	}
+	s.flusher, _ = c.Writer.(http.Flusher)
+	c.Set(ctxKeyStream, s.stat)
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") //关闭nginx缓冲
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	s.flush()
+
+	s.metrics.connections.WithLabelValues(s.path, kind).Inc()
+	//在当前协程获取请求的ctx，handler返回后gin会复用Context
+	ctx := c.Request.Context()
+	s.goroutine(func() {
+		s.watch(ctx)
+	})
+	return s
+}
+
+// goroutine 启动后台协程，finish时等待其退出
+func (s *stream) goroutine(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
+// watch 客户端断开时关闭流
+func (s *stream) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		s.close(streamCloseDisconnect)
+	case <-s.done:
+	}
+}
+
+// finish handler返回时关闭流并等待后台协程退出，之后不会再写入gin的Writer
+func (s *stream) finish() {
+	s.close(streamCloseServer)
+	s.wg.Wait()
+}
+
+// write 写入一条完整的消息并立即刷新，event为是否计入消息数
+func (s *stream) write(p []byte, event bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	n, err := s.c.Writer.Write(p)
+	s.stat.Bytes += n
+	if err != nil {
+		s.closeLocked(streamCloseDisconnect)
+		return ErrStreamClosed
+	}
+	s.flush()
+	if event {
+		s.stat.Events++
+		s.metrics.events.WithLabelValues(s.path, s.stat.Kind).Inc()
+	}
+	return nil
+}
+
+func (s *stream) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *stream) close(reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closeLocked(reason)
+}
+
+// closeLocked 关闭流，reason为finish、server或disconnect
+func (s *stream) closeLocked(reason string) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.stat.Disconnected = reason == streamCloseDisconnect
+	close(s.done)
+
+	cost := time.Since(s.start)
+	s.metrics.connections.WithLabelValues(s.path, s.stat.Kind).Dec()
+	s.metrics.duration.WithLabelValues(s.path, s.stat.Kind, reason).Observe(cost.Seconds())
+	Logger.Debug("stream closed",
+		zap.String("path", s.path),
+		zap.String("kind", s.stat.Kind),
+		zap.String("reason", reason),
+		zap.Int("events", s.stat.Events),
+		zap.Duration("cost", cost),
+	)
+}
+
+// SSEEvent 一条Server-Sent Events消息
+type SSEEvent struct {
+	ID    string        //消息id，客户端重连时通过Last-Event-ID请求头带回
+	Event string        //事件类型，为空时客户端触发message事件
+	Data  interface{}   //消息内容，string与[]byte原样输出，其他类型序列化为json
+	Retry time.Duration //客户端断线重连间隔
+}
+
+// SSEStream Server-Sent Events写入器，并发安全
+type SSEStream struct {
+	*stream
+	heartbeat time.Duration
+}
+
+type SSEOption func(s *SSEStream)
+
+// WithSSEHeartbeat 设置心跳间隔，默认15秒，小于等于0时不发送心跳
+func WithSSEHeartbeat(d time.Duration) SSEOption {
+	return func(s *SSEStream) {
+		s.heartbeat = d
+	}
+}
+
+// SSE 开始Server-Sent Events响应，在fn中推送消息，自动发送心跳，客户端断开后Done关闭
+// fn返回(包括panic)后流自动关闭，并等待心跳协程退出后才返回:
+//
+//	this.SSE(func(stream *ginlib.SSEStream) {
+//		for {
+//			select {
+//			case msg := <-ch:
+//				if err := stream.Event("progress", msg); err != nil {
+//					return
+//				}
+//			case <-stream.Done():
+//				return
+//			}
+//		}
+//	})
+func (c *Context) SSE(fn func(s *SSEStream), opts ...SSEOption) {
+	s := &SSEStream{heartbeat: 15 * time.Second}
+	for _, o := range opts {
+		o(s)
+	}
+	s.stream = newStream(c, StreamKindSSE, "text/event-stream; charset=utf-8")
+	if s.heartbeat > 0 {
+		s.goroutine(s.heartbeatLoop)
+	}
+	defer s.finish()
+	fn(s)
+}
+
+func (s *SSEStream) heartbeatLoop() {
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write([]byte(": ping\n\n"), false); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Send 发送一条消息，流已关闭或客户端已断开时返回ErrStreamClosed
+func (s *SSEStream) Send(e SSEEvent) error {
+	var buf strings.Builder
+	if e.ID != "" {
+		buf.WriteString("id: " + sseLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + sseLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	if e.Data != nil {
+		data, err := sseData(e.Data)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(data, "\n") {
+			buf.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+		}
+	}
+	buf.WriteString("\n")
+	return s.write([]byte(buf.String()), true)
+}
+
+// Event 发送指定事件类型的消息
+func (s *SSEStream) Event(event string, data interface{}) error {
+	return s.Send(SSEEvent{Event: event, Data: data})
+}
+
+// Data 发送message事件的消息
+func (s *SSEStream) Data(data interface{}) error {
+	return s.Send(SSEEvent{Data: data})
+}
+
+// Retry 通知客户端断线重连间隔
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.Send(SSEEvent{Retry: d})
+}
+
+// Comment 发送注释，客户端会忽略
+func (s *SSEStream) Comment(comment string) error {
+	return s.write([]byte(": "+sseLine(comment)+"\n\n"), false)
+}
+
+// LastEventID 客户端重连时带回的最后一条消息id
+func (s *SSEStream) LastEventID() string {
+	return s.c.GetHeader("Last-Event-ID")
+}
+
+// Done 流关闭或客户端断开后关闭
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close 提前结束推送，之后的写入返回ErrStreamClosed
+func (s *SSEStream) Close() {
+	s.close(streamCloseFinish)
+}
+
+func sseData(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("sse消息序列化失败:%w", err)
+	}
+	return string(raw), nil
+}
+
+// sseLine id、event、注释中不能包含换行
+func sseLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// JsonLinesStream 分块输出JSON lines(每行一个json)，适用于大数据量导出，并发安全
+type JsonLinesStream struct {
+	*stream
+}
+
+// JsonLines 开始JSON lines流式响应，在fn中写入数据，filename不为空时作为附件下载
+// Write返回错误时停止写入，fn返回后流自动关闭
+func (c *Context) JsonLines(fn func(s *JsonLinesStream), filename ...string) {
+	if len(filename) > 0 && filename[0] != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename[0]))
+	}
+	s := &JsonLinesStream{stream: newStream(c, StreamKindJsonLines, "application/x-ndjson; charset=utf-8")}
+	defer s.finish()
+	fn(s)
+}
+
+// Write 写入一行，流已关闭或客户端已断开时返回ErrStreamClosed
+func (s *JsonLinesStream) Write(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(append(raw, '\n'), true)
+}
+
+// Done 流关闭或客户端断开后关闭
+func (s *JsonLinesStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close 提前结束输出，之后的写入返回ErrStreamClosed
+func (s *JsonLinesStream) Close() {
+	s.close(streamCloseFinish)
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGinLoggerWithConfig(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	ginlib.Logger = zap.New(core)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.GinLoggerWithConfig(ginlib.AccessLogConfig{
+		SkipPaths:     []string{"/health", "/static/*"},
+		BodyMaxBytes:  128,
+		Headers:       true,
+		SlowThreshold: 20 * time.Millisecond,
+	}))
+	r.GET("/health", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/static/a.js", func(c *gin.Context) { c.String(200, "js") })
+	r.POST("/login", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.JsonSucc(gin.H{"token": "abc", "name": this.InputStr("name")})
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.String(200, strings.Repeat("a", 200))
+	})
+
+	for _, path := range []string{"/health", "/static/a.js"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if logs.Len() != 0 {
+		t.Error("过滤路径仍记录了日志", logs.TakeAll())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login?pwd=123&a=1", strings.NewReader(`{"name":"tom","password":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer xxx")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"name":"tom"`) {
+		t.Error("记录请求体影响了参数读取", w.Body.String())
+	}
+	entries := logs.TakeAll()
+	if len(entries) != 1 {
+		t.Fatal("日志条数错误", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_body"] != `{"name":"tom","password":"***"}` || fields["query"] != "pwd=***&a=1" {
+		t.Error("请求脱敏错误", fields["request_body"], fields["query"])
+	}
+	if !strings.Contains(fields["response_body"].(string), `"token":"***"`) {
+		t.Error("响应脱敏错误", fields["response_body"])
+	}
+	if fields["headers"].(map[string]string)["Authorization"] != "***" {
+		t.Error("请求头脱敏错误", fields["headers"])
+	}
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	entries = logs.TakeAll()
+	if len(entries) != 1 || entries[0].Level != zapcore.WarnLevel || !strings.HasSuffix(entries[0].ContextMap()["response_body"].(string), "...(truncated)") {
+		t.Error("慢请求或截断错误", entries)
+	}
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindReq struct {
+	Id       int64    `form:"id" valid:"required;min=1"`
+	Name     string   `json:"name" valid:"required;max=5"`
+	Page     int      `form:"page" default:"1"`
+	Status   string   `form:"status" valid:"in=on|off"`
+	Tags     []string `form:"tags"`
+	Disabled bool     `form:"disabled"`
+}
+
+func TestBind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var req bindReq
+	r.POST("/user/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if err := this.Bind(&req); err != nil {
+			this.JsonError(err)
+			return
+		}
+		this.JsonSucc(req)
+	})
+
+	w := httptest.NewRecorder()
+	body := `{"name":"tom","tags":["a","b"],"disabled":true}`
+	httpReq, _ := http.NewRequest("POST", "/user/12?status=on", strings.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, httpReq)
+	if req.Id != 12 || req.Name != "tom" || req.Page != 1 || req.Status != "on" || len(req.Tags) != 2 || !req.Disabled {
+		t.Error("绑定结果错误", req, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	httpReq, _ = http.NewRequest("POST", "/user/0?status=x", strings.NewReader("name=toolong"))
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ServeHTTP(w, httpReq)
+	var resp ginlib.GinJsonResp
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	fields, _ := resp.Data.(map[string]interface{})
+	if resp.ErrorCode == 0 || len(fields) != 3 {
+		t.Error("校验结果错误", w.Body.String())
+	}
+	t.Log(w.Body.String())
+}
+
+func TestBindRegex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	type codeReq struct {
+		Code string `form:"code" valid:"regex=^[a-z]{3}$"`
+	}
+	type badReq struct {
+		Code string `form:"code" valid:"regex=[a-z"`
+	}
+	bind := func(query string, obj interface{}) error {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		this := ginlib.Context{Context: c}
+		return this.Bind(obj)
+	}
+	if err := bind("code=abc", &codeReq{}); err != nil {
+		t.Error("regex校验错误", err)
+	}
+	var fieldErrs ginlib.FieldErrors
+	if err := bind("code=abcd", &codeReq{}); !errors.As(err, &fieldErrs) {
+		t.Error("不匹配时应返回参数错误", err)
+	}
+	//规则配置错误时返回error而不是panic
+	for i := 0; i < 2; i++ {
+		if err := bind("code=abc", &badReq{}); err == nil || errors.As(err, &fieldErrs) {
+			t.Error("regex配置错误未返回error", err)
+		}
+	}
+	type badMinReq struct {
+		Code string `form:"code" valid:"min=abc"`
+	}
+	if err := bind("code=abc", &badMinReq{}); err == nil || errors.As(err, &fieldErrs) {
+		t.Error("min配置错误未返回error", err)
+	}
+	type unknownReq struct {
+		Code string `form:"code" valid:"unknown"`
+	}
+	if err := bind("code=abc", &unknownReq{}); err == nil || errors.As(err, &fieldErrs) {
+		t.Error("未知的校验规则未返回error", err)
+	}
+}
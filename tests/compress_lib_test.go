@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimitAndDecompress(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.BodyLimitWareWithConfig(ginlib.BodyLimitConfig{
+		Default: 16,
+		Routes:  map[string]int64{"/big": 1 << 10},
+	}), ginlib.DecompressWare(0))
+	echo := func(c *gin.Context) {
+		data, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(200, string(data))
+	}
+	r.POST("/small", echo)
+	r.POST("/big", echo)
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(httptest.NewRequest(http.MethodPost, "/small", strings.NewReader("hello"))); w.Body.String() != "hello" {
+		t.Error("未超出限制时被拒绝", w.Body.String())
+	}
+	long := strings.Repeat("a", 100)
+	if w := do(httptest.NewRequest(http.MethodPost, "/small", strings.NewReader(long))); !strings.Contains(w.Body.String(), `"error_code":4131`) {
+		t.Error("超出限制未拒绝", w.Body.String())
+	}
+	//未知长度的请求体
+	req := httptest.NewRequest(http.MethodPost, "/small", ioutil.NopCloser(strings.NewReader(long)))
+	req.ContentLength = -1
+	if w := do(req); !strings.Contains(w.Body.String(), `"error_code":4131`) {
+		t.Error("chunked请求体超出限制未拒绝", w.Body.String())
+	}
+	if w := do(httptest.NewRequest(http.MethodPost, "/big", strings.NewReader(long))); w.Body.String() != long {
+		t.Error("路由限制未生效", w.Body.String())
+	}
+
+	//gzip请求体解压，解压后的大小同样受限制
+	gzipBody := func(s string) *http.Request {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		gw.Write([]byte(s))
+		gw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/big", buf)
+		req.Header.Set("Content-Encoding", "gzip")
+		return req
+	}
+	if w := do(gzipBody(long)); w.Body.String() != long {
+		t.Error("gzip请求体解压失败", w.Body.String())
+	}
+	if w := do(gzipBody(strings.Repeat("a", 2<<10))); !strings.Contains(w.Body.String(), `"error_code":4131`) {
+		t.Error("解压后超出限制未拒绝", w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPost, "/big", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	if w := do(req); !strings.Contains(w.Body.String(), `"error_code":4001`) {
+		t.Error("无效的gzip应返回格式错误", w.Body.String())
+	}
+}
+
+func TestCompressWare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.CompressWareWithConfig(ginlib.CompressConfig{MinSize: 100}))
+	long := strings.Repeat("hello ", 100)
+	r.GET("/json", func(c *gin.Context) { c.JSON(200, gin.H{"data": long}) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(200, gin.H{"data": "hi"}) })
+	r.GET("/png", func(c *gin.Context) { c.Data(200, "image/png", []byte(long)) })
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/json", "gzip, deflate, br")
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatal("应优先使用brotli", w.Header())
+	}
+	data, err := ioutil.ReadAll(brotli.NewReader(w.Body))
+	if err != nil || !strings.Contains(string(data), long) {
+		t.Error("brotli解压失败", err)
+	}
+
+	w = do("/json", "gzip;q=1, br;q=0.5")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("应按q值选择gzip", w.Header())
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadAll(gr); err != nil || !strings.Contains(string(data), long) {
+		t.Error("gzip解压失败", err)
+	}
+
+	if w = do("/small", "gzip"); w.Header().Get("Content-Encoding") != "" || !strings.Contains(w.Body.String(), "hi") {
+		t.Error("小于MinSize不应压缩", w.Header())
+	}
+	if w = do("/png", "gzip"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("不在列表中的Content-Type不应压缩", w.Header())
+	}
+	if w = do("/json", "identity"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("不支持压缩时不应压缩", w.Header())
+	}
+	//CompressWare之后的中间件得到压缩前的长度
+	size := 0
+	r = gin.New()
+	r.Use(ginlib.CompressWareWithConfig(ginlib.CompressConfig{MinSize: 100}), func(c *gin.Context) {
+		c.Next()
+		size = c.Writer.Size()
+	})
+	r.GET("/text", func(c *gin.Context) { c.String(200, long) })
+	if w = do("/text", "gzip"); w.Header().Get("Content-Encoding") != "gzip" || size != len(long) || w.Body.Len() >= len(long) {
+		t.Error("Size应为压缩前的长度", size, w.Body.Len())
+	}
+}
+
+// TestCompressWarePanic 缓存响应期间panic时恢复原来的Writer，由GinRecovery输出未压缩的错误
+func TestCompressWarePanic(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	restored := false
+	r := gin.New()
+	r.Use(ginlib.GinRecoveryWithOptions(), func(c *gin.Context) {
+		writer := c.Writer
+		defer func() {
+			restored = c.Writer == writer
+		}()
+		c.Next()
+	}, ginlib.CompressWareWithConfig(ginlib.CompressConfig{MinSize: 100}))
+	r.GET("/panic", func(c *gin.Context) {
+		c.String(200, "partial")
+		panic("boom")
+	})
+	r.GET("/text", func(c *gin.Context) { c.String(200, strings.Repeat("hello ", 100)) })
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/panic")
+	if !restored {
+		t.Error("panic后未恢复原来的Writer")
+	}
+	if w.Header().Get("Content-Encoding") != "" || strings.Contains(w.Body.String(), "partial") ||
+		!strings.Contains(w.Body.String(), `"error_code":5000`) {
+		t.Error("panic时应丢弃缓存的内容并输出错误", w.Header(), w.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		w = do("/text")
+		gr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadAll(gr); err != nil || len(data) != 600 {
+			t.Error("panic后压缩异常", err, len(data))
+		}
+	}
+}
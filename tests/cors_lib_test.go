@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf, err := ginlib.ParseCorsConfig(`{
+		"allow_origins":["https://a.com","https://*.b.com"],
+		"allow_headers":["Content-Type","Authorization"],
+		"allow_credentials":true,
+		"max_age":"1h",
+		"routes":{"/open/*":{"allow_origins":["*"],"allow_methods":["GET"]}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	r := gin.New()
+	r.Use(ginlib.CorsWithConfig(conf))
+	r.POST("/api/order", func(c *gin.Context) { calls++; c.String(200, "ok") })
+	r.GET("/open/list", func(c *gin.Context) { calls++; c.String(200, "ok") })
+	do := func(method, path, origin, reqMethod string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", reqMethod)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	//预检请求直接返回，不执行handler
+	w := do(http.MethodOptions, "/api/order", "https://x.b.com", "POST")
+	if w.Code != http.StatusNoContent || calls != 0 || w.Header().Get("Access-Control-Allow-Origin") != "https://x.b.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" || w.Header().Get("Access-Control-Max-Age") != "3600" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" {
+		t.Error("预检请求处理错误", w.Code, calls, w.Header())
+	}
+	if w = do(http.MethodOptions, "/api/order", "https://b.com", "POST"); w.Code != http.StatusForbidden {
+		t.Error("通配只应匹配子域名", w.Code)
+	}
+	if w = do(http.MethodOptions, "/api/order", "https://a.com", "TRACE"); w.Code != http.StatusForbidden {
+		t.Error("不允许的方法应拒绝", w.Code)
+	}
+
+	w = do(http.MethodPost, "/api/order", "https://a.com", "")
+	if calls != 1 || w.Header().Get("Access-Control-Allow-Origin") != "https://a.com" || w.Header().Get("Vary") != "Origin" {
+		t.Error("简单请求处理错误", calls, w.Header())
+	}
+	if w = do(http.MethodPost, "/api/order", "http://a.com", ""); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("不允许的来源不应返回跨域头", w.Header())
+	}
+
+	//按路由覆盖
+	if w = do(http.MethodGet, "/open/list", "https://c.com", ""); w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("路由配置未生效", w.Header())
+	}
+	if w = do(http.MethodOptions, "/open/list", "https://c.com", "POST"); w.Code != http.StatusForbidden {
+		t.Error("路由配置的方法未生效", w.Code)
+	}
+
+	//默认Cors允许所有来源但不携带cookie
+	r = gin.New()
+	r.Use(ginlib.Cors())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	if w = do(http.MethodOptions, "/", "https://any.com", "GET"); w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Cors处理错误", w.Code, w.Header())
+	}
+
+	//允许所有来源时忽略AllowCredentials，不返回请求的来源
+	r = gin.New()
+	r.Use(ginlib.CorsWithConfig(ginlib.CorsConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}))
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+	if w = do(http.MethodGet, "/", "https://evil.com", ""); w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("允许所有来源时不应携带cookie", w.Header())
+	}
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"crypto/rand"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCsrfWare(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.CsrfWare(ginlib.CsrfConfig{Secret: "secret", ExemptPaths: []string{"/api/*"}}))
+	r.GET("/form", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		c.String(200, this.CsrfToken())
+	})
+	r.POST("/form", func(c *gin.Context) { c.String(200, "ok") })
+	r.POST("/api/order", func(c *gin.Context) { c.String(200, "ok") })
+	do := func(req *http.Request, cookie *http.Cookie) *httptest.ResponseRecorder {
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(httptest.NewRequest(http.MethodGet, "/form", nil), nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != w.Body.String() {
+		t.Fatal("未下发token", cookies, w.Body.String())
+	}
+	cookie := cookies[0]
+	if w = do(httptest.NewRequest(http.MethodGet, "/form", nil), cookie); len(w.Result().Cookies()) != 0 || w.Body.String() != cookie.Value {
+		t.Error("已有有效token时不应重新下发", w.Result().Cookies())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", cookie.Value)
+	if w = do(req, cookie); w.Body.String() != "ok" {
+		t.Error("请求头提交token校验失败", w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(url.Values{"_csrf": {cookie.Value}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if w = do(req, cookie); w.Body.String() != "ok" {
+		t.Error("表单提交token校验失败", w.Body.String())
+	}
+	if w = do(httptest.NewRequest(http.MethodPost, "/form", nil), cookie); !strings.Contains(w.Body.String(), `"error_code":4031`) {
+		t.Error("未提交token应拒绝", w.Body.String())
+	}
+
+	//未签名的伪造token
+	forged := &http.Cookie{Name: cookie.Name, Value: "forged"}
+	req = httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", "forged")
+	if w = do(req, forged); !strings.Contains(w.Body.String(), `"error_code":4031`) {
+		t.Error("签名错误的token应拒绝", w.Body.String())
+	}
+
+	if w = do(httptest.NewRequest(http.MethodPost, "/api/order", nil), nil); w.Body.String() != "ok" {
+		t.Error("豁免路径不应校验", w.Body.String())
+	}
+}
+
+// failReader 模拟随机数生成失败
+type failReader struct{}
+
+func (failReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestCsrfWareUid(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if uid, err := strconv.ParseInt(c.GetHeader("uid"), 10, 64); err == nil {
+			c.Set("uid", uid)
+		}
+	}, ginlib.CsrfWare(ginlib.CsrfConfig{Secret: "secret"}))
+	r.GET("/form", func(c *gin.Context) { c.String(200, "ok") })
+	r.POST("/form", func(c *gin.Context) { c.String(200, "ok") })
+	do := func(method, uid string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/form", nil)
+		req.Header.Set("uid", uid)
+		if cookie != nil {
+			req.AddCookie(cookie)
+			req.Header.Set("X-CSRF-Token", cookie.Value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	//子域名为攻击者自己的账号获取的token，不能用于其他用户
+	cookies := do(http.MethodGet, "1", nil).Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("未下发token", cookies)
+	}
+	if w := do(http.MethodPost, "1", cookies[0]); w.Body.String() != "ok" {
+		t.Error("同一用户的token校验失败", w.Body.String())
+	}
+	if w := do(http.MethodPost, "2", cookies[0]); !strings.Contains(w.Body.String(), `"error_code":4031`) {
+		t.Error("其他用户的token应拒绝", w.Body.String())
+	}
+	if w := do(http.MethodGet, "2", cookies[0]); len(w.Result().Cookies()) != 1 {
+		t.Error("登录用户变化后应重新下发token")
+	}
+
+	//随机数生成失败时不能下发token
+	reader := rand.Reader
+	rand.Reader = failReader{}
+	defer func() {
+		rand.Reader = reader
+	}()
+	w := do(http.MethodGet, "3", nil)
+	if len(w.Result().Cookies()) != 0 || !strings.Contains(w.Body.String(), `"error_code":5000`) {
+		t.Error("随机数生成失败时不应下发token", w.Result().Cookies(), w.Body.String())
+	}
+}
+
+// TestCsrfWareLogin 未登录时下发的token在登录接口中按新uid重新下发，登录后的首个POST请求可通过校验
+func TestCsrfWareLogin(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if uid, err := strconv.ParseInt(c.GetHeader("uid"), 10, 64); err == nil {
+			c.Set("uid", uid)
+		}
+	}, ginlib.CsrfWare(ginlib.CsrfConfig{Secret: "secret"}))
+	r.GET("/form", func(c *gin.Context) { c.String(200, "ok") })
+	r.POST("/login", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if _, err := this.CsrfRefresh(5); err != nil {
+			t.Error(err)
+		}
+		c.String(200, "ok")
+	})
+	r.POST("/form", func(c *gin.Context) { c.String(200, "ok") })
+	do := func(method, path, uid string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("uid", uid)
+		if cookie != nil {
+			req.AddCookie(cookie)
+			req.Header.Set("X-CSRF-Token", cookie.Value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	anonymous := do(http.MethodGet, "/form", "", nil).Result().Cookies()
+	if len(anonymous) != 1 {
+		t.Fatal("未下发token", anonymous)
+	}
+	w := do(http.MethodPost, "/login", "", anonymous[0])
+	cookies := w.Result().Cookies()
+	if w.Body.String() != "ok" || len(cookies) != 1 || cookies[0].Value == anonymous[0].Value {
+		t.Fatal("登录后未按新uid下发token", w.Body.String(), cookies)
+	}
+	if w = do(http.MethodPost, "/form", "5", cookies[0]); w.Body.String() != "ok" {
+		t.Error("登录后的首个POST请求校验失败", w.Body.String())
+	}
+	if w = do(http.MethodPost, "/form", "5", anonymous[0]); !strings.Contains(w.Body.String(), `"error_code":4031`) {
+		t.Error("登录后未登录时的token应拒绝", w.Body.String())
+	}
+}
+
+func TestSecureHeadersWare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.SecureHeadersWare(ginlib.SecureHeadersConfig{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		ContentTypeNosniff:    true,
+		ReferrerPolicy:        "no-referrer",
+		CSP:                   "script-src 'self' 'nonce-{nonce}'",
+	}))
+	r.GET("/", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		c.String(200, this.CspNonce())
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	r.ServeHTTP(w, req)
+	nonce := w.Body.String()
+	if nonce == "" || w.Header().Get("Content-Security-Policy") != "script-src 'self' 'nonce-"+nonce+"'" {
+		t.Error("CSP nonce错误", nonce, w.Header().Get("Content-Security-Policy"))
+	}
+	if w.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" ||
+		w.Header().Get("X-Frame-Options") != "DENY" || w.Header().Get("X-Content-Type-Options") != "nosniff" ||
+		w.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Error("安全响应头错误", w.Header())
+	}
+
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w2.Body.String() == nonce || w2.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("nonce应每个请求不同，http请求不应设置HSTS", w2.Header())
+	}
+
+	//随机数生成失败时不能使用可预测的nonce
+	reader := rand.Reader
+	rand.Reader = failReader{}
+	defer func() {
+		rand.Reader = reader
+	}()
+	w3 := httptest.NewRecorder()
+	r.ServeHTTP(w3, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w3.Header().Get("Content-Security-Policy") != "" || !strings.Contains(w3.Body.String(), `"error_code":5000`) {
+		t.Error("随机数生成失败时应返回错误", w3.Header(), w3.Body.String())
+	}
+}
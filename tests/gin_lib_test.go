@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInputErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/list", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if _, err := this.InputIntE("page"); err == nil {
+			t.Error("page格式错误未返回error")
+		}
+		if size, err := this.InputIntE("size", 20); err != nil || size != 20 {
+			t.Error("size默认值错误", size, err)
+		}
+		//与Bind使用相同的bool解析
+		if on, err := this.InputBoolE("on"); err != nil || !on {
+			t.Error("bool参数解析错误", on, err)
+		}
+		this.MustInputInt("page")
+		this.MustInputStr("keyword")
+		this.MustInputInt64("uid")
+		if err := this.InputErrors(); err != nil {
+			this.JsonError(err)
+			return
+		}
+		this.JsonSucc(nil)
+	})
+
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest("GET", "/list?page=abc&uid=3&on=on", nil)
+	r.ServeHTTP(w, httpReq)
+	var resp ginlib.GinJsonResp
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	fields, _ := resp.Data.(map[string]interface{})
+	if len(fields) != 2 {
+		t.Error("参数错误收集结果错误", w.Body.String())
+	}
+	t.Log(w.Body.String())
+}
+
+func TestInputSources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ginlib.InputHeaders["app_version"] = "X-App-Version"
+	defer delete(ginlib.InputHeaders, "app_version")
+	r := gin.New()
+	r.POST("/user/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if this.InputInt64("id") != 9 || this.InputStr("name") != "tom" || this.InputInt("age") != 18 || this.InputStr("app_version") != "1.2.0" {
+			t.Error("参数读取错误")
+		}
+		//请求体可以重复读取
+		raw, _ := c.GetRawData()
+		t.Log(string(raw))
+	})
+	r.POST("/order", ginlib.InputSourcesWare(ginlib.InputSourceJson, ginlib.InputSourceQuery), func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if this.InputStr("no") != "json" {
+			t.Error("参数查找顺序错误", this.InputStr("no"))
+		}
+	})
+
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest("POST", "/user/9", strings.NewReader(`{"name":"tom","age":18}`))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-App-Version", "1.2.0")
+	r.ServeHTTP(w, httpReq)
+
+	w = httptest.NewRecorder()
+	httpReq, _ = http.NewRequest("POST", "/order?no=query", strings.NewReader(`{"no":"json"}`))
+	httpReq.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, httpReq)
+}
+
+func TestInputSliceMapTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/list", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if ids := this.InputIntSlice("ids"); len(ids) != 3 || ids[2] != 3 {
+			t.Error("InputIntSlice错误", ids)
+		}
+		if tags := this.InputStrSlice("tag"); len(tags) != 2 || tags[1] != "b" {
+			t.Error("InputStrSlice错误", tags)
+		}
+		if filter := this.InputMap("filter"); filter["status"] != "1" {
+			t.Error("InputMap错误", filter)
+		}
+		start := this.InputTime("start", "2006-01-02", ginlib.LocalUtc7())
+		if start.Day() != 2 || start.Location().String() != "Asia/Ho_Chi_Minh" {
+			t.Error("InputTime错误", start)
+		}
+		if end := this.InputTime("end", ginlib.InputTimeUnixMilli, nil); end.Unix() != 1700000000 {
+			t.Error("InputTime时间戳错误", end)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest("GET", "/list?ids=1,2,3&tag=a&tag=b&filter[status]=1&start=2024-01-02&end=1700000000000", nil)
+	r.ServeHTTP(w, httpReq)
+}
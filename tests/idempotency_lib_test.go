@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyWare(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	var orders, fails int32
+	block := make(chan struct{})
+	r := gin.New()
+	r.Use(ginlib.IdempotencyWare(nil))
+	r.POST("/order", func(c *gin.Context) {
+		n := atomic.AddInt32(&orders, 1)
+		if c.Query("wait") != "" {
+			<-block
+		}
+		c.JSON(201, gin.H{"order": n})
+	})
+	r.POST("/fail", func(c *gin.Context) {
+		atomic.AddInt32(&fails, 1)
+		this := ginlib.Context{Context: c}
+		this.JsonError(ginlib.ErrSystem.New())
+	})
+	doBody := func(path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(ginlib.IdempotencyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	do := func(path, key string) *httptest.ResponseRecorder {
+		return doBody(path, key, "")
+	}
+
+	first := do("/order", "k1")
+	second := do("/order", "k1")
+	if orders != 1 || second.Code != 201 || second.Body.String() != first.Body.String() ||
+		second.Header().Get(ginlib.IdempotencyReplayedHeader) != "true" {
+		t.Error("重试未返回保存的响应", orders, second.Code, second.Body.String())
+	}
+
+	//相同的幂等键用于不同的请求时拒绝
+	if w := doBody("/order", "k1", `{"amount":100}`); !strings.Contains(w.Body.String(), `"error_code":4220`) {
+		t.Error("请求体不一致时未拒绝", w.Body.String())
+	}
+	if w := do("/order?coupon=1", "k1"); !strings.Contains(w.Body.String(), `"error_code":4220`) {
+		t.Error("请求参数不一致时未拒绝", w.Body.String())
+	}
+	if orders != 1 {
+		t.Error("请求不一致时不应执行", orders)
+	}
+
+	do("/order", "k2")
+	do("/order", "")
+	if orders != 3 {
+		t.Error("不同的幂等键或无幂等键应重新执行", orders)
+	}
+
+	//首次请求处理中时重复请求返回处理中
+	done := make(chan struct{})
+	go func() {
+		do("/order?wait=1", "k3")
+		close(done)
+	}()
+	for atomic.LoadInt32(&orders) != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if w := do("/order?wait=1", "k3"); !strings.Contains(w.Body.String(), `"error_code":4090`) {
+		t.Error("并发重复请求未返回处理中", w.Body.String())
+	}
+	close(block)
+	<-done
+
+	//系统错误不保存，重试时重新执行
+	do("/fail", "k4")
+	do("/fail", "k4")
+	if fails != 2 {
+		t.Error("5xx错误不应保存响应", fails)
+	}
+}
+
+type failIdempotencyStore struct{}
+
+func (failIdempotencyStore) Acquire(key string, lockTTL time.Duration) (*ginlib.IdempotentResponse, string, error) {
+	return nil, "", errors.New("redis down")
+}
+
+func (failIdempotencyStore) Save(key, token string, resp *ginlib.IdempotentResponse, ttl time.Duration) error {
+	return errors.New("redis down")
+}
+
+func (failIdempotencyStore) Release(key, token string) error {
+	return errors.New("redis down")
+}
+
+// TestIdempotencyWareStoreError 存储出错时默认拒绝请求，开启WithIdempotencyFailOpen时放行
+func TestIdempotencyWareStoreError(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	for _, failOpen := range []bool{false, true} {
+		executed := false
+		r := gin.New()
+		r.Use(ginlib.IdempotencyWare(failIdempotencyStore{}, ginlib.WithIdempotencyFailOpen(failOpen)))
+		r.POST("/order", func(c *gin.Context) {
+			executed = true
+			c.String(200, "ok")
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/order", nil)
+		req.Header.Set(ginlib.IdempotencyHeader, "k1")
+		r.ServeHTTP(w, req)
+		if failOpen && (!executed || w.Body.String() != "ok") {
+			t.Error("fail open时未放行", w.Body.String())
+		}
+		if !failOpen && (executed || !strings.Contains(w.Body.String(), `"error_code":5031`)) {
+			t.Error("存储出错时未拒绝", executed, w.Body.String())
+		}
+	}
+}
+
+// TestIdempotencyWareMaxBody 计算摘要时请求体超出上限返回ErrBodyTooLarge
+func TestIdempotencyWareMaxBody(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.IdempotencyWare(nil, ginlib.WithIdempotencyMaxBody(10)))
+	r.POST("/order", func(c *gin.Context) {
+		c.String(200, "ok")
+	})
+	for _, chunked := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(strings.Repeat("a", 20)))
+		if chunked {
+			req.ContentLength = -1
+		}
+		req.Header.Set(ginlib.IdempotencyHeader, "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), `"error_code":4131`) {
+			t.Error("请求体超出上限未拒绝", chunked, w.Body.String())
+		}
+	}
+}
+
+// TestMemoryIdempotencyStoreToken 锁过期被其他请求获取后，原请求不能保存响应或释放新锁
+func TestMemoryIdempotencyStoreToken(t *testing.T) {
+	store := ginlib.NewMemoryIdempotencyStore()
+	_, token1, err := store.Acquire("k1", 10*time.Millisecond)
+	if err != nil || token1 == "" {
+		t.Fatal("加锁失败", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, token2, err := store.Acquire("k1", time.Minute)
+	if err != nil || token2 == "" || token2 == token1 {
+		t.Fatal("锁过期后未重新加锁", token1, token2, err)
+	}
+	if err = store.Release("k1", token1); err != nil {
+		t.Fatal(err)
+	}
+	if _, token, _ := store.Acquire("k1", time.Minute); token != "" {
+		t.Error("过期的token释放了新的锁")
+	}
+	if err = store.Save("k1", token1, &ginlib.IdempotentResponse{Status: 200}, time.Minute); err == nil {
+		t.Error("过期的token保存了响应")
+	}
+	if err = store.Save("k1", token2, &ginlib.IdempotentResponse{Status: 201}, time.Minute); err != nil {
+		t.Error("持有锁时保存失败", err)
+	}
+	if resp, _, _ := store.Acquire("k1", time.Minute); resp == nil || resp.Status != 201 {
+		t.Error("未返回保存的响应", resp)
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/apolloconfig/agollo/v4/env/config"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInnerClient(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.InnerAuthWare(ginlib.WithInnerAuthSecrets(func(caller string) (string, bool) {
+		secrets := map[string]string{"order": "secret", "pay": "pay_secret"}
+		secret, ok := secrets[caller]
+		return secret, ok
+	})))
+	r.POST("/user/info", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if caller := this.InnerCaller(); caller != "order" && caller != "pay" {
+			t.Error("调用方错误", this.InnerCaller())
+		}
+		this.InnerSucc(gin.H{"uid": this.InputInt64("uid"), "name": "tom"})
+	})
+	r.POST("/user/fail", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.InnerReturn(404, nil, "用户不存在")
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	client := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "order", "secret"
+	}))
+	var user struct {
+		Uid  int64  `json:"uid"`
+		Name string `json:"name"`
+	}
+	if err := client.Call(context.Background(), "/user/info", gin.H{"uid": 7}, &user); err != nil || user.Uid != 7 || user.Name != "tom" {
+		t.Error("内部服务调用失败", user, err)
+	}
+
+	err := client.Call(context.Background(), "/user/fail", nil, nil)
+	innerErr, ok := err.(*ginlib.InnerError)
+	if !ok || innerErr.Code != 404 || innerErr.Msg != "用户不存在" {
+		t.Error("内部服务错误解析失败", err)
+	}
+	t.Log(err)
+
+	forged := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "order", "wrong"
+	}))
+	err = forged.Call(context.Background(), "/user/info", nil, nil)
+	if innerErr, ok := err.(*ginlib.InnerError); !ok || innerErr.Code != 401 {
+		t.Error("签名错误的请求未被拒绝", err)
+	}
+
+	//使用order的密钥冒充pay调用
+	spoofed := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "pay", "secret"
+	}))
+	err = spoofed.Call(context.Background(), "/user/info", nil, nil)
+	if innerErr, ok := err.(*ginlib.InnerError); !ok || innerErr.Code != 401 {
+		t.Error("使用其他调用方密钥的请求未被拒绝", err)
+	}
+	pay := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "pay", "pay_secret"
+	}))
+	if err := pay.Call(context.Background(), "/user/info", gin.H{"uid": 8}, &user); err != nil || user.Uid != 8 {
+		t.Error("pay调用失败", user, err)
+	}
+}
+
+// innerTestApollo 模拟阿波罗服务端，所有集群返回相同的application.yml
+func innerTestApollo(content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/configfiles/json/"):
+			_ = json.NewEncoder(w).Encode(map[string]string{"content": content})
+		case strings.HasPrefix(r.URL.Path, "/configs/"):
+			parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"appId":          parts[1],
+				"cluster":        parts[2],
+				"namespaceName":  parts[3],
+				"configurations": map[string]string{"content": content},
+				"releaseKey":     "1",
+			})
+		case strings.HasPrefix(r.URL.Path, "/notifications/"):
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			_, _ = w.Write([]byte("[]"))
+		}
+	}))
+}
+
+// TestInnerAuthConfig InnerClient与InnerAuthWare都使用阿波罗中的配置
+func TestInnerAuthConfig(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.InnerAuthWare())
+	r.POST("/user/info", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.InnerSucc(gin.H{"caller": this.InnerCaller()})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	//原有配置只有server.user.caller与server.user.secret，pay使用独立的密钥
+	apollo := innerTestApollo(fmt.Sprintf(`server:
+  user:
+    host: %s
+    caller: order
+    secret: legacy_secret
+    callers:
+      pay:
+        secret: pay_secret
+`, srv.URL))
+	defer apollo.Close()
+	ginlib.Init("user", ginlib.WithApolloIp(apollo.URL), func(c *config.AppConfig) {
+		c.IsBackupConfig = false
+	})
+
+	var res struct {
+		Caller string `json:"caller"`
+	}
+	if err := ginlib.NewInnerClient("user").Call(context.Background(), "/user/info", nil, &res); err != nil || res.Caller != "order" {
+		t.Error("使用原有配置的内部服务调用失败", res, err)
+	}
+	pay := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "pay", "pay_secret"
+	}))
+	if err := pay.Call(context.Background(), "/user/info", nil, &res); err != nil || res.Caller != "pay" {
+		t.Error("使用独立密钥的内部服务调用失败", res, err)
+	}
+	//配置了独立密钥的调用方不能再使用原有的共享密钥
+	legacy := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "pay", "legacy_secret"
+	}))
+	if err := legacy.Call(context.Background(), "/user/info", nil, nil); err == nil {
+		t.Error("pay使用共享密钥的请求未被拒绝")
+	}
+	unknown := ginlib.NewInnerClient("user", ginlib.WithInnerResolver(func(name string) (host, caller, secret string) {
+		return srv.URL, "stock", "legacy_secret"
+	}))
+	if err := unknown.Call(context.Background(), "/user/info", nil, nil); err == nil {
+		t.Error("未配置的调用方未被拒绝")
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"github.com/zw2582/ginlib"
+	"testing"
+	"time"
+)
+
+func TestLifecycleStop(t *testing.T) {
+	l := ginlib.NewLifecycle()
+	l.StopTimeout = 100 * time.Millisecond
+	order := make([]string, 0)
+	l.OnStop("db", ginlib.StopPriorityDB, func(ctx context.Context) error {
+		order = append(order, "db")
+		return nil
+	})
+	l.OnStop("server", ginlib.StopPriorityServer, func(ctx context.Context) error {
+		if l.Ready() {
+			t.Error("停止时未将就绪状态置为false")
+		}
+		order = append(order, "server")
+		return nil
+	})
+	l.OnStop("slow", ginlib.StopPriorityConsumer, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	l.Stop()
+	<-l.Done()
+	if len(order) != 2 || order[0] != "server" || order[1] != "db" {
+		t.Error("停止顺序错误", order)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("停止钩子超时未生效", time.Since(start))
+	}
+}
+
+func TestLifecycleStopDedupe(t *testing.T) {
+	l := ginlib.NewLifecycle()
+	calls := make([]string, 0)
+	for _, val := range []string{"first", "second"} {
+		val := val
+		l.OnStop("logger", ginlib.StopPriorityLogger, func(ctx context.Context) error {
+			calls = append(calls, val)
+			return nil
+		})
+	}
+	l.Stop()
+	<-l.Done()
+	if len(calls) != 1 || calls[0] != "second" {
+		t.Error("同名停止钩子未被替换", calls)
+	}
+}
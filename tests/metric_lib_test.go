@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleRequestMetric(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	r := gin.New()
+	r.Use(ginlib.MiddleRequestMetricWithConfig(ginlib.RequestMetricConfig{Namespace: "demo-api", Registerer: reg}))
+	r.GET("/user/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if this.Param("id") == "0" {
+			this.JsonError(ginlib.ErrParam.New())
+			return
+		}
+		this.JsonSucc(this.Param("id"))
+	})
+	for _, path := range []string{"/user/1", "/user/2", "/user/0", "/none"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, val := range families {
+		names = append(names, val.GetName())
+	}
+	if !strings.Contains(strings.Join(names, ","), "demo_api_http_requests_in_flight") {
+		t.Error("指标前缀错误", names)
+	}
+	if cnt := testutil.CollectAndCount(reg, "demo_api_http_request_duration"); cnt != 3 {
+		t.Error("路由模板与错误码应产生3个序列", cnt)
+	}
+}
+
+// TestMiddleRequestMetricDeprecated 弃用期内默认中间件仍更新MetricRequestDuration
+func TestMiddleRequestMetricDeprecated(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.MiddleRequestMetric)
+	r.GET("/deprecated/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.JsonSucc(this.Param("id"))
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/deprecated/1", nil))
+
+	if cnt := testutil.CollectAndCount(ginlib.MetricRequestDuration); cnt == 0 {
+		t.Error("MetricRequestDuration未更新")
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, val := range families {
+		if strings.HasSuffix(val.GetName(), "http_requests_in_flight") && !strings.Contains(val.GetName(), "_http_requests_in_flight") {
+			t.Error("默认指标缺少前缀", val.GetName())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/list", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		p := this.Page(50)
+		if p.Page != 3 || p.PageSize != 50 || p.Offset() != 100 {
+			t.Error("分页参数错误", p)
+		}
+		this.JsonPage([]int{1, 2}, 102)
+	})
+
+	w := httptest.NewRecorder()
+	httpReq, _ := http.NewRequest("GET", "/list?page=3&page_size=500", nil)
+	r.ServeHTTP(w, httpReq)
+	var resp struct {
+		Data ginlib.PageResult `json:"data"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Data.Total != 102 || resp.Data.Page != 3 || resp.Data.PageSize != 50 {
+		t.Error("分页返回结构错误", w.Body.String())
+	}
+	t.Log(w.Body.String())
+
+	//页码过大时记录参数错误并限制偏移量
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/list?page=9223372036854775807", nil)
+	this := ginlib.Context{Context: c}
+	if p := this.Page(); p.Page != ginlib.PageMaxPage || p.Offset() < 0 || this.InputErrors() == nil {
+		t.Error("页码未限制", p, this.InputErrors())
+	}
+}
+
+func TestCursor(t *testing.T) {
+	p := ginlib.CursorSpec{Cursor: ginlib.CursorEncode(1024), PageSize: 2}
+	if val, err := p.Value(); err != nil || val != int64(1024) {
+		t.Error("游标解码错误", val, err)
+	}
+	list := []int{5, 4, 3}
+	if !ginlib.CursorTrim(&list, p) || len(list) != 2 {
+		t.Error("游标裁剪错误", list)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	rules, err := ginlib.ParseRateLimitRules(`[
+		{"route":"/login","method":"POST","key":"ip","limit":2,"window":"1m"},
+		{"route":"/api/*","key":"uid","algorithm":"token_bucket","limit":1,"window":"1h","burst":1}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ginlib.NewRateLimiter(nil, ginlib.WithRateLimitRules(rules...))
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("uid", int64(7))
+	}, limiter.Ware())
+	r.POST("/login", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/api/a", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/api/b", func(c *gin.Context) { c.String(200, "ok") })
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do(http.MethodPost, "/login"); w.Body.String() != "ok" {
+			t.Error("未超出限制时被拒绝", i, w.Body.String())
+		}
+	}
+	w := do(http.MethodPost, "/login")
+	if w.Header().Get("Retry-After") == "" || w.Body.String() == "ok" {
+		t.Error("超出限制未拒绝", w.Header(), w.Body.String())
+	}
+
+	if w = do(http.MethodGet, "/api/a"); w.Body.String() != "ok" {
+		t.Error("令牌桶首次请求被拒绝", w.Body.String())
+	}
+	if w = do(http.MethodGet, "/api/b"); w.Body.String() == "ok" || w.Header().Get("Retry-After") != "3600" {
+		t.Error("前缀规则应共享令牌桶", w.Header(), w.Body.String())
+	}
+
+	//热更新规则
+	limiter.SetRules([]ginlib.RateLimitRule{{Route: "/login", Limit: 100, Window: time.Minute, Name: "login2"}})
+	if w = do(http.MethodPost, "/login"); w.Body.String() != "ok" {
+		t.Error("更新规则后未生效", w.Body.String())
+	}
+}
+
+// TestRateLimiterLayered 同一路由叠加多条规则时默认名称不同，计数互不影响
+func TestRateLimiterLayered(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	limiter := ginlib.NewRateLimiter(nil, ginlib.WithRateLimitRules(
+		ginlib.RateLimitRule{Route: "/login", Method: http.MethodPost, Limit: 2, Window: time.Minute},
+		ginlib.RateLimitRule{Route: "/login", Method: http.MethodPost, Limit: 3, Window: time.Hour},
+	))
+	rules := limiter.Rules()
+	if len(rules) != 2 || rules[0].Name == rules[1].Name {
+		t.Fatal("叠加规则的默认名称重复", rules)
+	}
+	r := gin.New()
+	r.Use(limiter.Ware())
+	r.POST("/login", func(c *gin.Context) { c.String(200, "ok") })
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		if ok := w.Body.String() == "ok"; ok != (i < 2) {
+			t.Error("叠加规则计数错误", i, w.Body.String())
+		}
+	}
+}
+
+func TestRateLimiterForwardedFor(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	rule := ginlib.RateLimitRule{Route: "/login", Key: ginlib.RateLimitKeyIP, Limit: 1, Window: time.Minute}
+	newRouter := func(opts ...ginlib.RateLimitOption) *gin.Engine {
+		r := gin.New()
+		r.Use(ginlib.NewRateLimiter(nil, append(opts, ginlib.WithRateLimitRules(rule))...).Ware())
+		r.POST("/login", func(c *gin.Context) { c.String(200, "ok") })
+		return r
+	}
+	do := func(r *gin.Engine, remote, forwarded string) string {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	//未配置可信代理时伪造X-Forwarded-For不能重置限额
+	r := newRouter()
+	if body := do(r, "203.0.113.9:5000", "1.1.1.1"); body != "ok" {
+		t.Error("首次请求被拒绝", body)
+	}
+	if body := do(r, "203.0.113.9:5000", "2.2.2.2"); body == "ok" {
+		t.Error("伪造X-Forwarded-For绕过了限流")
+	}
+
+	//来自可信代理的请求按X-Forwarded-For中的客户端ip限流，客户端追加的ip无效
+	r = newRouter(ginlib.WithRateLimitTrustedProxies("10.0.0.0/8"))
+	if body := do(r, "10.0.0.2:5000", "1.1.1.1"); body != "ok" {
+		t.Error("可信代理转发的请求被拒绝", body)
+	}
+	if body := do(r, "10.0.0.2:5000", "2.2.2.2"); body != "ok" {
+		t.Error("可信代理转发的不同客户端共享了限额", body)
+	}
+	if body := do(r, "10.0.0.3:5000", "9.9.9.9, 1.1.1.1"); body == "ok" {
+		t.Error("客户端在X-Forwarded-For中追加的ip绕过了限流")
+	}
+}
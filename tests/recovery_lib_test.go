@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGinRecoveryWithOptions(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	var lock sync.Mutex
+	events := make([]ginlib.PanicEvent, 0)
+	r := gin.New()
+	r.Use(ginlib.GinRecoveryWithOptions(
+		ginlib.WithPanicReporter(ginlib.PanicReporterFunc(func(e ginlib.PanicEvent) {
+			lock.Lock()
+			events = append(events, e)
+			lock.Unlock()
+		})),
+		ginlib.WithPanicHandler(func(c *ginlib.Context, e ginlib.PanicEvent) {
+			c.String(http.StatusServiceUnavailable, "busy:"+e.Fingerprint)
+		}),
+	))
+	r.GET("/a", func(c *gin.Context) { panic("a") })
+	r.GET("/b", func(c *gin.Context) { panic("b") })
+
+	fingerprints := make([]string, 0)
+	for _, path := range []string{"/a", "/a", "/b"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Error("自定义响应未生效", w.Code)
+		}
+		fingerprints = append(fingerprints, w.Body.String())
+	}
+	if fingerprints[0] != fingerprints[1] || fingerprints[0] == fingerprints[2] {
+		t.Error("指纹错误", fingerprints)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	if len(events) != 2 || events[0].Count != 1 || events[0].Err.Error() == events[1].Err.Error() {
+		t.Error("同一指纹在上报间隔内应只上报一次", events)
+	}
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	ginlib.Logger = zap.New(core)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.RequestIDWare())
+	r.GET("/user/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.Log().Info("handler")
+		ginlib.LoggerFrom(c.Request.Context()).Info("service")
+		this.JsonSucc(this.RequestID())
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/user/1", nil)
+	req.Header.Set(ginlib.RequestIDHeader, "abc-123")
+	r.ServeHTTP(w, req)
+	if w.Header().Get(ginlib.RequestIDHeader) != "abc-123" {
+		t.Error("未沿用请求头中的请求id", w.Header())
+	}
+	for _, entry := range logs.TakeAll() {
+		fields := entry.ContextMap()
+		if fields["request_id"] != "abc-123" || fields["route"] != "/user/:id" || fields["ip"] == "" {
+			t.Error("日志缺少请求信息", entry.Message, fields)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/user/1", nil)
+	req.Header.Set(ginlib.RequestIDHeader, "bad id\n")
+	r.ServeHTTP(w, req)
+	if id := w.Header().Get(ginlib.RequestIDHeader); id == "" || id == "bad id\n" {
+		t.Error("非法请求id未重新生成", id)
+	}
+}
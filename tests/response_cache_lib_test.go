@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	cache := ginlib.NewResponseCache(nil, ginlib.WithResponseCacheRules(
+		ginlib.ResponseCacheRule{Route: "/product/:id", TTL: time.Minute, Tags: []string{"product"}},
+	))
+	calls := 0
+	codes := make([]string, 0)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		this := ginlib.Context{Context: c}
+		if code, ok := this.ErrorCode(); ok {
+			codes = append(codes, strconv.Itoa(code))
+		} else {
+			codes = append(codes, "")
+		}
+	}, cache.Ware())
+	r.GET("/product/:id", func(c *gin.Context) {
+		calls++
+		this := ginlib.Context{Context: c}
+		if c.Param("id") == "0" {
+			this.JsonError(ginlib.ErrParam.New())
+			return
+		}
+		this.CacheTags("product:" + c.Param("id"))
+		this.JsonSucc(gin.H{"id": c.Param("id"), "calls": calls})
+	})
+	r.POST("/product/:id", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		if err := this.CacheInvalidate("product:" + c.Param("id")); err != nil {
+			t.Error(err)
+		}
+		this.JsonSucc(nil)
+	})
+	do := func(method, path, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do(http.MethodGet, "/product/1?b=2&a=1", "")
+	second := do(http.MethodGet, "/product/1?a=1&b=2", "")
+	if calls != 1 || second.Header().Get(ginlib.ResponseCacheHeader) != "HIT" || second.Body.String() != first.Body.String() {
+		t.Error("未命中缓存", calls, second.Header(), second.Body.String())
+	}
+	if len(codes) != 2 || codes[1] != "0" {
+		t.Error("命中缓存时未恢复业务错误码", codes)
+	}
+	etag := first.Header().Get("ETag")
+	if w := do(http.MethodGet, "/product/1?a=1&b=2", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Error("If-None-Match一致时应返回304", w.Code, w.Body.String())
+	}
+	do(http.MethodGet, "/product/2", "")
+	if calls != 2 {
+		t.Error("不同路径参数不应共享缓存", calls)
+	}
+
+	//错误响应不缓存
+	do(http.MethodGet, "/product/0", "")
+	do(http.MethodGet, "/product/0", "")
+	if calls != 4 {
+		t.Error("错误响应不应缓存", calls)
+	}
+
+	//按标签失效
+	do(http.MethodPost, "/product/1", "")
+	if w := do(http.MethodGet, "/product/1?a=1&b=2", etag); calls != 5 || w.Code != http.StatusOK {
+		t.Error("标签失效后未重新执行", calls, w.Code)
+	}
+	do(http.MethodGet, "/product/2", "")
+	if calls != 5 {
+		t.Error("其他标签的缓存不应失效", calls)
+	}
+	if err := cache.InvalidateTags("product"); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodGet, "/product/2", "")
+	if calls != 6 {
+		t.Error("规则标签失效后未重新执行", calls)
+	}
+
+}
+
+func TestResponseCacheUid(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	cache := ginlib.NewResponseCache(nil, ginlib.WithResponseCacheRules(
+		ginlib.ResponseCacheRule{Route: "/me", TTL: time.Minute, Uid: true},
+	))
+	calls := 0
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if uid := c.Query("uid"); uid != "" {
+			c.Set("uid", int64(len(uid)))
+		}
+	}, cache.Ware())
+	r.GET("/me", func(c *gin.Context) {
+		calls++
+		this := ginlib.Context{Context: c}
+		this.JsonSucc(gin.H{"uid": c.GetInt64("uid")})
+	})
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	do("/me")
+	if w := do("/me"); calls != 2 || w.Header().Get(ginlib.ResponseCacheHeader) != "" {
+		t.Error("没有uid时不应使用缓存", calls, w.Header())
+	}
+	do("/me?uid=a")
+	if w := do("/me?uid=a"); calls != 3 || w.Header().Get(ginlib.ResponseCacheHeader) != "HIT" {
+		t.Error("有uid时未命中缓存", calls, w.Header())
+	}
+	if vary := strings.Join(do("/me?uid=a").Header()["Vary"], ","); vary != "Accept-Language,Cookie,Authorization" {
+		t.Error("按uid缓存时Vary错误", vary)
+	}
+}
+
+// TestResponseCacheInvalidateDuringHandler handler执行期间标签失效时，本次缓存的响应不能再命中
+func TestResponseCacheInvalidateDuringHandler(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	cache := ginlib.NewResponseCache(nil, ginlib.WithResponseCacheRules(
+		ginlib.ResponseCacheRule{Route: "/list", TTL: time.Minute, Tags: []string{"list"}},
+		ginlib.ResponseCacheRule{Route: "/item/:id", TTL: time.Minute},
+	))
+	calls := 0
+	r := gin.New()
+	r.Use(cache.Ware())
+	r.GET("/list", func(c *gin.Context) {
+		calls++
+		this := ginlib.Context{Context: c}
+		//模拟读取数据后其他请求修改了数据
+		if calls == 1 {
+			_ = cache.InvalidateTags("list")
+		}
+		this.JsonSucc(calls)
+	})
+	r.GET("/item/:id", func(c *gin.Context) {
+		calls++
+		this := ginlib.Context{Context: c}
+		this.CacheTags("item:" + c.Param("id"))
+		if calls == 3 {
+			_ = this.CacheInvalidate("item:" + c.Param("id"))
+		}
+		this.JsonSucc(calls)
+	})
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	if w := do("/list"); w.Header().Get("Vary") != "Accept-Language" {
+		t.Error("缺少Vary头", w.Header())
+	}
+	do("/list")
+	if calls != 2 {
+		t.Error("handler执行期间规则标签失效后缓存仍命中", calls)
+	}
+	if w := do("/list"); calls != 2 || w.Header().Get(ginlib.ResponseCacheHeader) != "HIT" {
+		t.Error("未失效时应命中缓存", calls, w.Header())
+	}
+
+	do("/item/1")
+	do("/item/1")
+	if calls != 4 {
+		t.Error("handler执行期间追加的标签失效后缓存仍命中", calls)
+	}
+	if do("/item/1"); calls != 4 {
+		t.Error("未失效时应命中缓存", calls)
+	}
+}
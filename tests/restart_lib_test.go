@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const envRestartTestAddr = "GINLIB_TEST_RESTART_ADDR"
+
+// TestGracefulRestart 以子进程方式运行服务，发送SIGUSR2后新进程通过环境变量中的fd继承监听，
+// 并通过就绪管道通知旧进程，旧进程随后退出，监听地址始终可用
+func TestGracefulRestart(t *testing.T) {
+	if addr := os.Getenv(envRestartTestAddr); addr != "" {
+		restartTestServe(addr)
+		return
+	}
+
+	addr := serverTestAddr(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGracefulRestart$")
+	cmd.Env = append(os.Environ(), envRestartTestAddr+"="+addr)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- cmd.Wait()
+	}()
+	defer cmd.Process.Kill()
+	serverTestWait(t, "tcp", addr)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	pid, err := serverTestGet(client, "http://"+addr+"/pid")
+	if err != nil || pid != strconv.Itoa(cmd.Process.Pid) {
+		t.Fatal("子进程服务异常", pid, err)
+	}
+
+	if err = cmd.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-exitCh:
+		if err != nil {
+			t.Error("旧进程退出异常", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("新进程就绪后旧进程未退出")
+	}
+
+	newPid, err := serverTestGet(client, "http://"+addr+"/pid")
+	if err != nil || newPid == "" || newPid == pid {
+		t.Fatal("新进程未继承监听", newPid, err)
+	}
+	newProcess, _ := strconv.Atoi(newPid)
+	if err = syscall.Kill(newProcess, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+	_ = syscall.Kill(newProcess, syscall.SIGKILL)
+	t.Error("新进程收到退出信号后未停止")
+}
+
+func restartTestServe(addr string) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/pid", func(c *gin.Context) {
+		c.String(http.StatusOK, strconv.Itoa(os.Getpid()))
+	})
+	_ = ginlib.ServeWeb(r, ginlib.WithLifecycle(ginlib.NewLifecycle()), ginlib.WithGracefulRestart(5*time.Second),
+		ginlib.WithListener(ginlib.ListenerConfig{Addr: addr}))
+}
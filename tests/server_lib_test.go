@@ -0,0 +1,313 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"golang.org/x/net/http2"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func serverTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong %d", c.Request.ProtoMajor)
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	return r
+}
+
+// serverTestAddr 获取一个空闲的本地端口
+func serverTestAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// serverTestServe 在协程中启动服务，停止后通过channel返回ServeWeb的结果
+func serverTestServe(engine *gin.Engine, opts ...ginlib.ServerOption) chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ginlib.ServeWeb(engine, opts...)
+	}()
+	return errCh
+}
+
+// serverTestWait 等待监听可连接
+func serverTestWait(t *testing.T, network, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial(network, addr); err == nil {
+			_ = conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("服务未启动", addr)
+}
+
+func serverTestGet(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestServeWebListeners(t *testing.T) {
+	l := ginlib.NewLifecycle()
+	started := false
+	l.OnStart("warmup", 0, func(ctx context.Context) error {
+		started = true
+		return nil
+	})
+	addr1, addr2 := serverTestAddr(t), serverTestAddr(t)
+	admin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("admin"))
+	})
+	errCh := serverTestServe(serverTestEngine(), ginlib.WithLifecycle(l),
+		ginlib.WithListener(ginlib.ListenerConfig{Name: "api", Addr: addr1}),
+		ginlib.WithListener(ginlib.ListenerConfig{Name: "admin", Addr: addr2, Handler: admin}))
+	serverTestWait(t, "tcp", addr1)
+	serverTestWait(t, "tcp", addr2)
+
+	if body, err := serverTestGet(http.DefaultClient, "http://"+addr1+"/ping"); err != nil || body != "pong 1" {
+		t.Error("api监听请求失败", body, err)
+	}
+	if !started {
+		t.Error("开始服务前未执行启动钩子")
+	}
+	if body, err := serverTestGet(http.DefaultClient, "http://"+addr2+"/ping"); err != nil || body != "admin" {
+		t.Error("admin监听未使用自定义handler", body, err)
+	}
+	l.Stop()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+	if _, err := net.Dial("tcp", addr2); err == nil {
+		t.Error("停止后监听未关闭")
+	}
+}
+
+func TestServeWebStartFailed(t *testing.T) {
+	l := ginlib.NewLifecycle()
+	l.OnStart("warmup", 0, func(ctx context.Context) error {
+		return errors.New("warmup failed")
+	})
+	addr := serverTestAddr(t)
+	err := ginlib.ServeWeb(serverTestEngine(), ginlib.WithLifecycle(l), ginlib.WithListener(ginlib.ListenerConfig{Addr: addr}))
+	if err == nil {
+		t.Error("启动钩子失败时未返回错误")
+	}
+	if _, err = net.Dial("tcp", addr); err == nil {
+		t.Error("启动钩子失败后监听未关闭")
+	}
+}
+
+func TestServeWebUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ginlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "web.sock")
+
+	//模拟进程异常退出后残留的socket文件
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	_ = stale.Close()
+	if _, err := os.Stat(sock); err != nil {
+		t.Fatal("残留socket文件不存在", err)
+	}
+
+	l := ginlib.NewLifecycle()
+	errCh := serverTestServe(serverTestEngine(), ginlib.WithLifecycle(l),
+		ginlib.WithListener(ginlib.ListenerConfig{Network: "unix", Addr: sock}))
+	serverTestWait(t, "unix", sock)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	if body, err := serverTestGet(client, "http://unix/ping"); err != nil || body != "pong 1" {
+		t.Error("unix socket请求失败", body, err)
+	}
+	l.Stop()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Error("停止后socket文件未删除", err)
+	}
+
+	//普通文件不是残留的socket，不能被删除
+	if err := ioutil.WriteFile(sock, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ginlib.ServeWeb(serverTestEngine(), ginlib.WithLifecycle(ginlib.NewLifecycle()),
+		ginlib.WithListener(ginlib.ListenerConfig{Network: "unix", Addr: sock})); err == nil {
+		t.Error("socket路径为普通文件时未返回错误")
+	}
+	if data, _ := ioutil.ReadFile(sock); string(data) != "data" {
+		t.Error("普通文件被删除")
+	}
+}
+
+func TestServeWebH2C(t *testing.T) {
+	l := ginlib.NewLifecycle()
+	addr := serverTestAddr(t)
+	errCh := serverTestServe(serverTestEngine(), ginlib.WithLifecycle(l),
+		ginlib.WithListener(ginlib.ListenerConfig{Addr: addr, H2C: true}))
+	serverTestWait(t, "tcp", addr)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	if body, err := serverTestGet(client, "http://"+addr+"/ping"); err != nil || body != "pong 2" {
+		t.Error("h2c请求失败", body, err)
+	}
+	if body, err := serverTestGet(http.DefaultClient, "http://"+addr+"/ping"); err != nil || body != "pong 1" {
+		t.Error("开启h2c后http/1.1请求失败", body, err)
+	}
+	l.Stop()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+}
+
+// serverTestCert 生成自签名证书并写入文件
+func serverTestCert(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeWebCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ginlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	serverTestCert(t, certFile, keyFile, 1)
+
+	l := ginlib.NewLifecycle()
+	addr := serverTestAddr(t)
+	errCh := serverTestServe(serverTestEngine(), ginlib.WithLifecycle(l),
+		ginlib.WithListener(ginlib.ListenerConfig{Addr: addr, CertFile: certFile, KeyFile: keyFile}))
+	serverTestWait(t, "tcp", addr)
+
+	//替换证书与私钥，修改时间晚于首次加载
+	serverTestCert(t, certFile, keyFile, 2)
+	future := time.Now().Add(time.Minute)
+	if err = os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal("https握手失败", err)
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	_ = conn.Close()
+	if len(certs) == 0 || certs[0].SerialNumber.Int64() != 2 {
+		t.Error("证书替换后未重新加载")
+	}
+	l.Stop()
+	if err := <-errCh; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServeWebGracefulShutdown(t *testing.T) {
+	old := ginlib.DefaultLifecycle
+	ginlib.DefaultLifecycle = ginlib.NewLifecycle()
+	defer func() {
+		ginlib.DefaultLifecycle = old
+	}()
+	l := ginlib.DefaultLifecycle
+
+	addr := serverTestAddr(t)
+	errCh := serverTestServe(serverTestEngine(), ginlib.WithListener(ginlib.ListenerConfig{Addr: addr}))
+	serverTestWait(t, "tcp", addr)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		body, err := serverTestGet(&http.Client{Transport: &http.Transport{}}, "http://"+addr+"/slow")
+		resCh <- result{body, err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	l.Stop()
+	if l.Ready() {
+		t.Error("停止后仍为就绪状态")
+	}
+	if res := <-resCh; res.err != nil || res.body != "done" {
+		t.Error("停止时处理中的请求未完成", res.body, res.err)
+	}
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("停止后ServeWeb未返回")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("停止后监听未关闭")
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	root, _ := ioutil.TempDir("", "storage")
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+	store := ginlib.NewLocalStorage(root, "http://127.0.0.1/files", "secret")
+
+	for _, key := range []string{"a/1.txt", "a/2.txt", "b/1.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader(key), ginlib.PutOptions{Size: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Stat(ctx, "../etc/passwd"); err != ginlib.ErrObjectNotFound {
+		t.Error("不应访问根目录之外的文件", err)
+	}
+	if info, err := store.Stat(ctx, "a/1.txt"); err != nil || info.Size != 7 {
+		t.Error("Stat错误", info, err)
+	}
+	items, next, err := store.List(ctx, "a/", "", 1)
+	if err != nil || len(items) != 1 || items[0].Key != "a/1.txt" || next != "a/1.txt" {
+		t.Error("List第一页错误", items, next, err)
+	}
+	items, next, _ = store.List(ctx, "a/", next, 1)
+	if len(items) != 1 || items[0].Key != "a/2.txt" {
+		t.Error("List第二页错误", items, next)
+	}
+	_ = store.Delete(ctx, "a/1.txt")
+	if _, err = store.Get(ctx, "a/1.txt"); err != ginlib.ErrObjectNotFound {
+		t.Error("删除失败", err)
+	}
+
+	r := gin.New()
+	r.GET("/files/*key", store.Handler())
+	link, _ := store.Presign(ctx, "b/1.txt", http.MethodGet, time.Minute)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, "http://127.0.0.1"), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "b/1.txt" {
+		t.Error("临时地址访问失败", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/b/1.txt?expires=9999999999&sign=xx", nil))
+	if w.Code != http.StatusForbidden {
+		t.Error("签名错误未拒绝", w.Code)
+	}
+}
+
+func TestSaveUpload(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	root, _ := ioutil.TempDir("", "upload")
+	defer os.RemoveAll(root)
+	store := ginlib.NewLocalStorage(root, "", "")
+
+	r := gin.New()
+	r.POST("/upload", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		res, err := this.SaveUpload("file", ginlib.UploadOptions{MaxSize: 1024, Exts: []string{"png"}, MimeTypes: []string{"image/*"}, Storage: store})
+		if err != nil {
+			this.JsonError(err)
+			return
+		}
+		this.JsonSucc(res)
+	})
+	upload := func(filename string, content []byte) (int, ginlib.GinJsonResp) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		fw, _ := mw.CreateFormFile("file", filename)
+		_, _ = fw.Write(content)
+		_ = mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp ginlib.GinJsonResp
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	if _, resp := upload("a.PNG", png); resp.ErrorCode != 0 {
+		t.Error("上传失败", resp)
+	} else if data := resp.Data.(map[string]interface{}); data["content_type"] != "image/png" || data["filename"] != "a.PNG" {
+		t.Error("上传结果错误", data)
+	}
+	if _, resp := upload("a.png", []byte("<html></html>")); resp.ErrorCode != ginlib.ErrUploadType.Code {
+		t.Error("伪造扩展名未拒绝", resp)
+	}
+	if _, resp := upload("a.jpg", png); resp.ErrorCode != ginlib.ErrUploadType.Code {
+		t.Error("扩展名未拒绝", resp)
+	}
+	if _, resp := upload("a.png", append(png, make([]byte, 1024)...)); resp.ErrorCode != ginlib.ErrUploadTooLarge.Code {
+		t.Error("文件大小未限制", resp)
+	}
+}
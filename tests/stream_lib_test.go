@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/sse", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.SSE(func(stream *ginlib.SSEStream) {
+			defer stream.Close()
+			_ = stream.Send(ginlib.SSEEvent{ID: "1", Event: "progress", Data: gin.H{"percent": 50}, Retry: time.Second})
+			time.Sleep(30 * time.Millisecond)
+			_ = stream.Data("line1\nline2")
+		}, ginlib.WithSSEHeartbeat(10*time.Millisecond))
+	})
+	r.GET("/export", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.JsonLines(func(stream *ginlib.JsonLinesStream) {
+			for i := 0; i < 3; i++ {
+				_ = stream.Write(gin.H{"id": i})
+			}
+		}, "export.jsonl")
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream; charset=utf-8" {
+		t.Error("Content-Type错误", resp.Header.Get("Content-Type"))
+	}
+	if !strings.HasPrefix(string(body), "id: 1\nevent: progress\nretry: 1000\ndata: {\"percent\":50}\n\n") {
+		t.Error("消息格式错误", string(body))
+	}
+	if !strings.Contains(string(body), ": ping\n\n") || !strings.HasSuffix(string(body), "data: line1\ndata: line2\n\n") {
+		t.Error("心跳或多行数据错误", string(body))
+	}
+
+	resp, err = http.Get(srv.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "{\"id\":0}\n{\"id\":1}\n{\"id\":2}\n" || len(resp.TransferEncoding) == 0 {
+		t.Error("json lines输出错误", string(body), resp.TransferEncoding)
+	}
+}
+
+// TestSSEServerClose handler未调用Close直接返回时，流以server原因关闭，且心跳协程在handler返回前退出
+func TestSSEServerClose(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/sse_server", func(c *gin.Context) {
+		this := ginlib.Context{Context: c}
+		this.SSE(func(stream *ginlib.SSEStream) {
+			_ = stream.Data("hello")
+			time.Sleep(20 * time.Millisecond)
+		}, ginlib.WithSSEHeartbeat(time.Millisecond))
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for i := 0; i < 5; i++ {
+		resp, err := http.Get(srv.URL + "/sse_server")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.HasPrefix(string(body), "data: hello\n\n") {
+			t.Error("消息格式错误", string(body))
+		}
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for _, f := range families {
+		if !strings.HasSuffix(f.GetName(), "http_stream_duration_seconds") {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["path"] == "/sse_server" && labels["reason"] == "server" {
+				count += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	if count != 5 {
+		t.Error("handler返回时未以server原因关闭流", count)
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/zw2582/ginlib"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutWare(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.TimeoutWareWithConfig(ginlib.TimeoutConfig{
+		Default: 20 * time.Millisecond,
+		Routes:  map[string]time.Duration{"/long": time.Second},
+	}))
+	slow := func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+			c.String(200, "ok")
+		}
+	}
+	r.GET("/slow", slow)
+	r.GET("/long", slow)
+	r.GET("/err", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		this := ginlib.Context{Context: c}
+		this.JsonError(c.Request.Context().Err())
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if !strings.Contains(w.Body.String(), `"error_code":5040`) {
+		t.Error("超时未返回ErrTimeout", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/err", nil))
+	if !strings.Contains(w.Body.String(), `"error_code":5040`) {
+		t.Error("DeadlineExceeded未转换为ErrTimeout", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/long", nil))
+	if w.Body.String() != "ok" {
+		t.Error("路由超时配置未生效", w.Code, w.Body.String())
+	}
+}
+
+// TestTimeoutWareIgnoreCtx handler不检查ctx时，到达截止时间仍立即返回ErrTimeout，之后的输出被丢弃
+func TestTimeoutWareIgnoreCtx(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ginlib.TimeoutWare(20 * time.Millisecond))
+	r.GET("/sleep", func(c *gin.Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.String(200, "late")
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if cost := time.Since(start); cost > 200*time.Millisecond {
+		t.Error("超时响应等待了handler返回", cost)
+	}
+	if !strings.Contains(string(body), `"error_code":5040`) || strings.Contains(string(body), "late") {
+		t.Error("超时未返回ErrTimeout", string(body))
+	}
+	//handler协程中的panic交给GinRecovery处理
+	r = gin.New()
+	r.Use(ginlib.GinRecoveryWithOptions(), ginlib.TimeoutWare(time.Second))
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if !strings.Contains(w.Body.String(), `"error_code":5000`) {
+		t.Error("handler panic未被恢复", w.Body.String())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ginlib.Logger = zap.NewNop()
+	b := ginlib.NewCircuitBreaker("test", ginlib.CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+	})
+	fail := func() error { return errors.New("down") }
+	succ := func() error { return nil }
+
+	//业务错误与取消不计为失败
+	for i := 0; i < 3; i++ {
+		b.Do(func() error { return ginlib.ErrTimeout })
+		b.Do(func() error { return context.Canceled })
+	}
+	if b.State() != ginlib.CircuitClosed {
+		t.Fatal("业务错误不应触发熔断", b.State())
+	}
+
+	b.Do(fail)
+	b.Do(fail)
+	if b.State() != ginlib.CircuitOpen {
+		t.Fatal("连续失败后未打开", b.State())
+	}
+	called := false
+	if err := b.Do(func() error { called = true; return nil }); !errors.Is(err, ginlib.ErrCircuitOpen) || called {
+		t.Error("打开时应直接拒绝", err, called)
+	}
+
+	//半开探测失败后重新打开
+	time.Sleep(60 * time.Millisecond)
+	if b.State() != ginlib.CircuitHalfOpen {
+		t.Fatal("超时后未进入半开", b.State())
+	}
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal("半开时应放行探测请求", err)
+	}
+	if _, err = b.Allow(); !errors.Is(err, ginlib.ErrCircuitOpen) {
+		t.Error("半开时探测请求数超出限制应拒绝", err)
+	}
+	done(errors.New("down"))
+	if b.State() != ginlib.CircuitOpen {
+		t.Fatal("探测失败后未重新打开", b.State())
+	}
+
+	//半开探测成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	if err = b.Do(succ); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != ginlib.CircuitClosed {
+		t.Error("探测成功后未关闭", b.State())
+	}
+}
@@ -0,0 +1,191 @@
+package ginlib
+
+import (
+	"bytes"
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTimeout = BizErrorRegister(5040, "请求超时", http.StatusGatewayTimeout, zapcore.WarnLevel)
+)
+
+// TimeoutConfig 请求超时配置
+type TimeoutConfig struct {
+	Default time.Duration            //默认超时时间，0不限制
+	Routes  map[string]time.Duration //按路由模板设置超时时间，如"/export": time.Minute，0不限制
+}
+
+// TimeoutWare 为请求的context.Context设置截止时间
+func TimeoutWare(d time.Duration) gin.HandlerFunc {
+	return TimeoutWareWithConfig(TimeoutConfig{Default: d})
+}
+
+// TimeoutWareWithConfig 为请求的context.Context设置截止时间，可按路由设置不同的超时时间
+// 使用c.Request.Context()调用mysql、mongo、InnerClient等下游时，超时后下游调用立即返回错误，JsonError会将其转换为ErrTimeout
+// handler在单独的协程中执行，输出先写入缓冲区，到达截止时间时立即返回ErrTimeout并丢弃handler之后的输出，
+// 即使handler没有检查ctx也不会延迟超时响应；中间件仍会等待handler返回后再返回，避免gin复用仍在使用的Context
+// 响应会被缓冲，SSE等流式路由需在Routes中设置为0
+func TimeoutWareWithConfig(conf TimeoutConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := conf.Default
+		if val, ok := conf.Routes[c.FullPath()]; ok {
+			d = val
+		}
+		if d <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		//超时响应使用Context的副本输出，不与handler协程共用
+		w := c.Writer
+		cp := c.Copy()
+		tw := newTimeoutWriter(w)
+		c.Writer = tw
+
+		done := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				e := recover()
+				if e != nil && e != http.ErrAbortHandler {
+					e = newHandlerPanic(e)
+				}
+				done <- e
+			}()
+			c.Next()
+		}()
+
+		var panicked interface{}
+		select {
+		case panicked = <-done:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				tw.timeout()
+				//设置Content-Length并立即发送，客户端无需等待handler返回
+				resp := newTimeoutWriter(w)
+				cp.Writer = resp
+				this := Context{cp}
+				this.JsonError(ErrTimeout)
+				resp.header.Set("Content-Length", strconv.Itoa(resp.buf.Len()))
+				resp.flush()
+				w.Flush()
+			}
+			panicked = <-done
+		}
+		c.Writer = w
+		//handler的panic交给外层的GinRecovery处理
+		if panicked != nil {
+			panic(panicked)
+		}
+		if tw.timedOut {
+			c.Set(ctxKeyErrorCode, ErrTimeout.Code)
+			c.Abort()
+			return
+		}
+		tw.flush()
+	}
+}
+
+// timeoutWriter 缓存handler的响应，未超时时在handler返回后输出，超时后丢弃
+type timeoutWriter struct {
+	gin.ResponseWriter
+	lock     sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	written  bool
+	timedOut bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if code > 0 && !w.written && !w.timedOut {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	//超时后的输出直接丢弃，返回错误会使gin的Render panic
+	if w.timedOut {
+		return len(p), nil
+	}
+	w.written = true
+	return w.buf.Write(p)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.written {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.written
+}
+
+// Flush 响应需在handler返回后才能输出，忽略
+func (w *timeoutWriter) Flush() {
+}
+
+func (w *timeoutWriter) timeout() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.timedOut = true
+}
+
+// flush handler返回后输出缓存的响应
+func (w *timeoutWriter) flush() {
+	dst := w.ResponseWriter.Header()
+	for key, val := range w.header {
+		dst[key] = val
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if !w.written {
+		return
+	}
+	if w.buf.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+}
@@ -0,0 +1,136 @@
+package ginlib
+
+import (
+	"bytes"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// 上传相关的业务错误码
+var (
+	ErrUploadMissing  = BizErrorRegister(4002, "请上传文件%s", http.StatusBadRequest, zapcore.InfoLevel)
+	ErrUploadTooLarge = BizErrorRegister(4130, "文件大小不能超过%s", http.StatusRequestEntityTooLarge, zapcore.InfoLevel)
+	ErrUploadType     = BizErrorRegister(4150, "不支持的文件类型%s", http.StatusUnsupportedMediaType, zapcore.InfoLevel)
+)
+
+// UploadOptions SaveUpload的参数
+type UploadOptions struct {
+	MaxSize   int64    //文件大小上限，默认10M
+	Exts      []string //允许的扩展名，如.jpg、png，为空时不限制
+	MimeTypes []string //允许的文件类型，根据文件内容识别，支持image/或image/*这类前缀，为空时不限制
+	Dir       string   //存储目录，默认upload
+	//KeyFunc 自定义存储的key，ext为小写的扩展名，默认Dir/20060102/唯一id+ext
+	KeyFunc func(filename, ext string) string
+	Storage Storage //存储，默认DefaultStorage
+}
+
+// UploadResult 上传结果
+type UploadResult struct {
+	ObjectInfo
+	Filename string `json:"filename"` //客户端上传的原始文件名
+}
+
+// SaveUpload 校验表单中的上传文件并保存到存储中
+// 先限制请求体大小，再校验文件大小、扩展名与根据文件内容识别的类型，校验失败返回对应业务错误，可直接用于JsonError
+func (c *Context) SaveUpload(field string, opts UploadOptions) (res UploadResult, err error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 10 << 20
+	}
+	if opts.Dir == "" {
+		opts.Dir = "upload"
+	}
+	store := opts.Storage
+	if store == nil {
+		store = DefaultStorage
+	}
+	if store == nil {
+		return res, fmt.Errorf("未初始化存储，请先调用InitStorage或InitTxCloud")
+	}
+	//表单未解析时限制请求体大小，预留1M给其他表单字段
+	if c.Request.MultipartForm == nil {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, opts.MaxSize+1<<20)
+	}
+	fh, err := c.FormFile(field)
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			return res, ErrUploadTooLarge.New(uploadSizeStr(opts.MaxSize))
+		}
+		return res, ErrUploadMissing.New(field)
+	}
+	if fh.Size > opts.MaxSize {
+		return res, ErrUploadTooLarge.New(uploadSizeStr(opts.MaxSize))
+	}
+	ext := strings.ToLower(path.Ext(fh.Filename))
+	if len(opts.Exts) > 0 && !uploadMatch(opts.Exts, ext, false) {
+		return res, ErrUploadType.New(ext)
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	//读取文件头识别文件类型，不信任客户端的Content-Type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return res, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if len(opts.MimeTypes) > 0 && !uploadMatch(opts.MimeTypes, contentType, true) {
+		return res, ErrUploadType.New(contentType)
+	}
+
+	key := ""
+	if opts.KeyFunc != nil {
+		key = opts.KeyFunc(fh.Filename, ext)
+	} else {
+		key = strings.TrimRight(opts.Dir, "/") + "/" + time.Now().Format("20060102") + "/" + UniqueId() + ext
+	}
+	err = store.Put(c.Request.Context(), key, io.MultiReader(bytes.NewReader(head), f), PutOptions{ContentType: contentType, Size: fh.Size})
+	if err != nil {
+		Logger.Error("上传文件保存失败", zap.String("key", key), zap.Error(err))
+		return res, err
+	}
+	res.Key = key
+	res.Size = fh.Size
+	res.ContentType = contentType
+	res.ModTime = time.Now()
+	res.Filename = fh.Filename
+	return res, nil
+}
+
+// uploadMatch 判断val是否在允许列表中，prefix为true时支持image/这类前缀匹配
+func uploadMatch(allows []string, val string, prefix bool) bool {
+	if prefix {
+		//去掉; charset=utf-8这类参数
+		val = strings.TrimSpace(strings.Split(val, ";")[0])
+	}
+	for _, allow := range allows {
+		allow = strings.TrimSuffix(strings.ToLower(allow), "*")
+		if !prefix && !strings.HasPrefix(allow, ".") {
+			allow = "." + allow
+		}
+		if allow == val || (prefix && strings.HasSuffix(allow, "/") && strings.HasPrefix(val, allow)) {
+			return true
+		}
+	}
+	return false
+}
+
+func uploadSizeStr(size int64) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dM", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dK", size>>10)
+	}
+	return fmt.Sprintf("%dB", size)
+}
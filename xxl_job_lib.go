@@ -1,6 +1,7 @@
 package ginlib
 
 import (
+	"context"
 	"fmt"
 	xxl "github.com/xxl-job/xxl-job-executor-go"
 	"go.uber.org/zap"
@@ -25,6 +26,10 @@ func XXLJobCreate(logHandle xxl.LogHandler) (exec xxl.Executor, err error) {
 	exec.Init()
 	//设置日志查看handler
 	exec.LogHandler(logHandle)
+	DefaultLifecycle.OnStop("xxl job", StopPriorityConsumer, func(ctx context.Context) error {
+		exec.Stop()
+		return nil
+	})
 
 	Logger.Info("初始化xxlJob", zap.String("Addr", xxlAddr), zap.String("Token", xxlToken), zap.String("Key", xxlKey))
 	return exec, nil